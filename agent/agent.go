@@ -171,9 +171,26 @@ func gatherWithTimeout(
 	}
 }
 
+// initInputs initializes the inputs implementing telegraf.Initializer.
+func (a *Agent) initInputs() error {
+	for _, input := range a.Config.Inputs {
+		if p, ok := input.Input.(telegraf.Initializer); ok {
+			if err := p.Init(); err != nil {
+				return fmt.Errorf("could not initialize input %s: %s",
+					input.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
 // Test verifies that we can 'Gather' from all inputs with their configured
 // Config struct
 func (a *Agent) Test() error {
+	if err := a.initInputs(); err != nil {
+		return err
+	}
+
 	shutdown := make(chan struct{})
 	defer close(shutdown)
 	metricC := make(chan telegraf.Metric)
@@ -208,7 +225,15 @@ func (a *Agent) Test() error {
 			fmt.Printf("* Internal: %s\n", input.Config.Interval)
 		}
 
-		if err := input.Input.Gather(acc); err != nil {
+		if d, ok := input.Input.(telegraf.Diagnoser); ok {
+			diagnostics, err := d.GatherDiagnostics(acc)
+			if err != nil {
+				return err
+			}
+			for _, line := range diagnostics {
+				fmt.Printf("* %s\n", line)
+			}
+		} else if err := input.Input.Gather(acc); err != nil {
 			return err
 		}
 
@@ -366,6 +391,10 @@ func (a *Agent) Run(shutdown chan struct{}) error {
 
 	now := time.Now()
 
+	if err := a.initInputs(); err != nil {
+		return err
+	}
+
 	// Start all ServicePlugins
 	for _, input := range a.Config.Inputs {
 		input.SetDefaultTags(a.Config.Tags)
@@ -424,6 +453,14 @@ func (a *Agent) Run(shutdown chan struct{}) error {
 	}
 
 	wg.Wait()
+	for _, input := range a.Config.Inputs {
+		if _, ok := input.Input.(telegraf.ServiceInput); ok {
+			continue
+		}
+		if p, ok := input.Input.(telegraf.Stopper); ok {
+			p.Stop()
+		}
+	}
 	a.Close()
 	return nil
 }
@@ -1,5 +1,13 @@
 package telegraf
 
+// Initializer is implemented by plugins that validate their configuration
+// or set up state once, before they are used.
+type Initializer interface {
+	// Init performs one time setup of the plugin and returns an error if the
+	// configuration is invalid.
+	Init() error
+}
+
 type Input interface {
 	// SampleConfig returns the default configuration of the Input
 	SampleConfig() string
@@ -29,3 +37,18 @@ type ServiceInput interface {
 	// Stop stops the services and closes any necessary channels and connections
 	Stop()
 }
+
+// Stopper is implemented by inputs that need to release resources, such as
+// requests still in flight, when the agent stops.  Service inputs are
+// stopped through ServiceInput instead.
+type Stopper interface {
+	Stop()
+}
+
+// Diagnoser is implemented by inputs that can explain a gather.  The agent
+// calls GatherDiagnostics in place of Gather in --test mode.
+type Diagnoser interface {
+	// GatherDiagnostics gathers like Gather and returns the steps of the
+	// gather, one per line.
+	GatherDiagnostics(acc Accumulator) ([]string, error)
+}
@@ -67,6 +67,59 @@ func (d *Duration) UnmarshalTOML(b []byte) error {
 	return nil
 }
 
+// Size just wraps an int64 number of bytes
+type Size struct {
+	Size int64
+}
+
+// Multipliers of the units accepted by Size
+var sizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"KIB": 1024,
+	"MIB": 1024 * 1024,
+	"GIB": 1024 * 1024 * 1024,
+}
+
+// UnmarshalTOML parses the size from the TOML config file, either a number
+// of bytes or a string with a unit, ie, "4MiB"
+func (s *Size) UnmarshalTOML(b []byte) error {
+	b = bytes.Trim(b, `'`)
+
+	if sI, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+		s.Size = sI
+		return nil
+	}
+
+	str, err := strconv.Unquote(string(b))
+	if err != nil {
+		str = string(b)
+	}
+	str = strings.TrimSpace(str)
+	i := strings.IndexFunc(str, func(r rune) bool {
+		return !unicode.IsDigit(r)
+	})
+	if i == 0 {
+		return fmt.Errorf("invalid size '%s'", str)
+	}
+	if i < 0 {
+		i = len(str)
+	}
+	n, err := strconv.ParseInt(str[:i], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size '%s': %s", str, err)
+	}
+	unit, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(str[i:]))]
+	if !ok {
+		return fmt.Errorf("invalid size '%s': unknown unit", str)
+	}
+	s.Size = n * unit
+	return nil
+}
+
 // ReadLines reads contents from a file and splits them by new lines.
 // A convenience wrapper to ReadLinesOffsetN(filename, 0, -1).
 func ReadLines(filename string) ([]string, error) {
@@ -155,3 +155,30 @@ func TestDuration(t *testing.T) {
 	d.UnmarshalTOML([]byte(`1.5`))
 	assert.Equal(t, time.Second, d.Duration)
 }
+
+func TestSize(t *testing.T) {
+	var s Size
+
+	assert.NoError(t, s.UnmarshalTOML([]byte(`1024`)))
+	assert.Equal(t, int64(1024), s.Size)
+
+	s = Size{}
+	assert.NoError(t, s.UnmarshalTOML([]byte(`"4MB"`)))
+	assert.Equal(t, int64(4000000), s.Size)
+
+	s = Size{}
+	assert.NoError(t, s.UnmarshalTOML([]byte(`'4MiB'`)))
+	assert.Equal(t, int64(4*1024*1024), s.Size)
+
+	s = Size{}
+	assert.NoError(t, s.UnmarshalTOML([]byte(`"512 kib"`)))
+	assert.Equal(t, int64(512*1024), s.Size)
+
+	s = Size{}
+	assert.NoError(t, s.UnmarshalTOML([]byte(`"100B"`)))
+	assert.Equal(t, int64(100), s.Size)
+
+	s = Size{}
+	assert.Error(t, s.UnmarshalTOML([]byte(`"4XB"`)))
+	assert.Error(t, s.UnmarshalTOML([]byte(`"MB"`)))
+}
@@ -0,0 +1,89 @@
+package nginx
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// urlBreakers tracks the consecutive failures of every URL.  A URL that
+// failed threshold times in a row is skipped for backoff, doubled on every
+// failed retry up to maxBackoff, until it is gathered successfully again.
+type urlBreakers struct {
+	mu         sync.Mutex
+	threshold  int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	states     map[string]*breakerState
+}
+
+type breakerState struct {
+	failures  int
+	open      bool
+	openUntil time.Time
+}
+
+func newURLBreakers(threshold int, backoff, maxBackoff time.Duration) *urlBreakers {
+	if backoff <= 0 {
+		backoff = time.Minute
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = time.Hour
+	}
+	if maxBackoff < backoff {
+		maxBackoff = backoff
+	}
+	return &urlBreakers{
+		threshold:  threshold,
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+		states:     make(map[string]*breakerState),
+	}
+}
+
+// allow reports whether the URL is due to be gathered.
+func (b *urlBreakers) allow(url string, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state, ok := b.states[url]
+	return !ok || !state.open || !now.Before(state.openUntil)
+}
+
+// record updates the state of the URL with the outcome of a gather.
+func (b *urlBreakers) record(url string, err error, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state, ok := b.states[url]
+	if err == nil {
+		if ok {
+			if state.open {
+				log.Printf("I! nginx: %s recovered, gathering it again", url)
+			}
+			delete(b.states, url)
+		}
+		return
+	}
+
+	if !ok {
+		state = &breakerState{}
+		b.states[url] = state
+	}
+	state.failures++
+	if state.failures < b.threshold {
+		return
+	}
+
+	delay := b.maxBackoff
+	// The shift is bounded so the doubling cannot overflow
+	if shift := uint(state.failures - b.threshold); shift < 32 {
+		if d := b.backoff << shift; d > 0 && d < b.maxBackoff {
+			delay = d
+		}
+	}
+	state.openUntil = now.Add(delay)
+	if !state.open {
+		state.open = true
+		log.Printf("W! nginx: %s failed %d times in a row, skipping it for up to %s",
+			url, state.failures, b.maxBackoff)
+	}
+}
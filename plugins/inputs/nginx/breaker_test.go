@@ -0,0 +1,81 @@
+package nginx
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLBreakers(t *testing.T) {
+	const url = "http://localhost/status"
+	failed := errors.New("connection refused")
+	b := newURLBreakers(2, time.Minute, 3*time.Minute)
+	now := time.Now()
+
+	assert.True(t, b.allow(url, now))
+	b.record(url, failed, now)
+	assert.True(t, b.allow(url, now))
+	b.record(url, failed, now)
+	assert.False(t, b.allow(url, now))
+	assert.False(t, b.allow(url, now.Add(59*time.Second)))
+
+	// The backoff doubles on every failed retry up to the maximum
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow(url, now))
+	b.record(url, failed, now)
+	assert.False(t, b.allow(url, now.Add(time.Minute)))
+	now = now.Add(2 * time.Minute)
+	assert.True(t, b.allow(url, now))
+	b.record(url, failed, now)
+	assert.False(t, b.allow(url, now.Add(2*time.Minute)))
+	assert.True(t, b.allow(url, now.Add(3*time.Minute)))
+
+	// A success resets the URL
+	now = now.Add(3 * time.Minute)
+	b.record(url, nil, now)
+	b.record(url, failed, now)
+	assert.True(t, b.allow(url, now))
+	assert.Empty(t, b.states[url].openUntil)
+}
+
+func TestURLBreakersLongOutage(t *testing.T) {
+	b := newURLBreakers(1, time.Minute, time.Hour)
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		b.record("http://localhost/status", errors.New("timeout"), now)
+	}
+	state := b.states["http://localhost/status"]
+	assert.Equal(t, now.Add(time.Hour), state.openUntil)
+}
+
+func TestNginxCircuitBreaker(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:                    []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		CircuitBreakerThreshold: 2,
+		CircuitBreakerBackoff:   internal.Duration{Duration: time.Hour},
+	}
+	for i := 0; i < 4; i++ {
+		var acc testutil.Accumulator
+		require.NoError(t, n.Gather(&acc))
+		// Skipped URLs are neither an error nor scraped
+		assert.Equal(t, i < 2, len(acc.Errors) == 1, "gather %d", i)
+		assert.Equal(t, i < 2, acc.HasMeasurement("nginx_scrape"), "gather %d", i)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
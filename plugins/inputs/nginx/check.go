@@ -0,0 +1,165 @@
+package nginx
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+)
+
+// URLCheck is the outcome of CheckURL.
+type URLCheck struct {
+	URL string
+	// Format the response was parsed as, empty when it was not parsed
+	Parser  string
+	Metrics []telegraf.Metric
+	// Steps of the gather in the order they happened
+	Diagnostics []string
+	Duration    time.Duration
+	Err         error
+}
+
+func (c *URLCheck) logf(format string, args ...interface{}) {
+	if c == nil {
+		return
+	}
+	c.Diagnostics = append(c.Diagnostics, fmt.Sprintf(format, args...))
+}
+
+type checkKey struct{}
+
+// checkFromContext returns the URLCheck of a gather started by CheckURL, nil
+// for the gathers of the agent.
+func checkFromContext(ctx context.Context) *URLCheck {
+	check, _ := ctx.Value(checkKey{}).(*URLCheck)
+	return check
+}
+
+// CheckURL gathers address once with the options of n and returns what was
+// gathered instead of adding it to an accumulator.  It is meant for trying
+// out the URL, authentication and TLS options of a new status page before
+// adding it to the configuration, address does not have to be one of the
+// configured URLs and is not added to them.
+func (n *Nginx) CheckURL(address string) *URLCheck {
+	if n.client == nil {
+		if err := n.setup(); err != nil {
+			return &URLCheck{URL: address, Err: err}
+		}
+	}
+	addr, err := parseAddress(address)
+	if err != nil {
+		return &URLCheck{URL: address, Err: err}
+	}
+
+	acc := &checkAccumulator{}
+	check := n.check(newTarget(addr, nil), acc)
+	check.URL = address
+	check.Metrics = acc.metrics
+	for _, err := range acc.errors {
+		check.logf("error: %s", err)
+	}
+	if check.Err == nil {
+		check.logf("gathered %d metrics in %s", len(acc.metrics), check.Duration)
+	}
+	return check
+}
+
+// GatherDiagnostics gathers the configured URLs one after the other and
+// returns the steps of each gather, prefixed with its URL.  telegraf --test
+// uses it in place of Gather to show why a URL fails.
+func (n *Nginx) GatherDiagnostics(acc telegraf.Accumulator) ([]string, error) {
+	if n.client == nil {
+		if err := n.Init(); err != nil {
+			return nil, err
+		}
+	}
+
+	var diagnostics []string
+	for _, t := range n.gatherTargets(acc) {
+		check := n.check(t, acc)
+		if check.Err != nil {
+			acc.AddError(check.Err)
+		} else {
+			check.logf("gathered in %s", check.Duration)
+		}
+		for _, line := range check.Diagnostics {
+			diagnostics = append(diagnostics, check.URL+": "+line)
+		}
+	}
+	return diagnostics, nil
+}
+
+// check gathers t into acc and records the steps of the gather.
+func (n *Nginx) check(t target, acc telegraf.Accumulator) *URLCheck {
+	check := &URLCheck{URL: t.addr.String()}
+	ctx := context.WithValue(n.ctx, checkKey{}, check)
+	start := time.Now()
+	check.Err = n.gatherUrl(ctx, t, acc)
+	check.Duration = time.Since(start)
+	if check.Err != nil {
+		check.logf("failed: %s", check.Err)
+	}
+	return check
+}
+
+// checkAccumulator keeps the metrics added to it.
+type checkAccumulator struct {
+	metrics []telegraf.Metric
+	errors  []error
+}
+
+func (a *checkAccumulator) add(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	valueType telegraf.ValueType,
+	t ...time.Time,
+) {
+	tm := time.Now()
+	if len(t) > 0 {
+		tm = t[0]
+	}
+	m, err := metric.New(measurement, tags, fields, tm, valueType)
+	if err != nil {
+		a.AddError(err)
+		return
+	}
+	a.metrics = append(a.metrics, m)
+}
+
+func (a *checkAccumulator) AddFields(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	a.add(measurement, fields, tags, telegraf.Untyped, t...)
+}
+
+func (a *checkAccumulator) AddGauge(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	a.add(measurement, fields, tags, telegraf.Gauge, t...)
+}
+
+func (a *checkAccumulator) AddCounter(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	a.add(measurement, fields, tags, telegraf.Counter, t...)
+}
+
+func (a *checkAccumulator) SetPrecision(precision, interval time.Duration) {}
+
+func (a *checkAccumulator) AddError(err error) {
+	if err != nil {
+		a.errors = append(a.errors, err)
+	}
+}
@@ -0,0 +1,82 @@
+package nginx
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNginxCheckURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/vts" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, vtsSampleResponse)
+			return
+		}
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{}
+	check := n.CheckURL(ts.URL + "/stub_status")
+	require.NoError(t, check.Err)
+	assert.Empty(t, n.Urls)
+	assert.Equal(t, "stub_status", check.Parser)
+	var measurements []string
+	for _, m := range check.Metrics {
+		measurements = append(measurements, m.Name())
+	}
+	assert.Equal(t, []string{"nginx", "nginx", "nginx_scrape"}, measurements)
+	assert.Equal(t, "GET "+ts.URL+"/stub_status", check.Diagnostics[0])
+	assert.Contains(t, strings.Join(check.Diagnostics, "\n"), "HTTP status 200 OK")
+
+	// Further URLs are checked with the same options
+	check = n.CheckURL(ts.URL + "/vts")
+	require.NoError(t, check.Err)
+	assert.Equal(t, "vts", check.Parser)
+
+	check = n.CheckURL(ts.URL + "/missing")
+	require.Error(t, check.Err)
+	assert.Empty(t, check.Parser)
+	assert.Contains(t, check.Diagnostics[len(check.Diagnostics)-1], "404 Not Found")
+
+	check = (&Nginx{}).CheckURL("http://[::1")
+	assert.Error(t, check.Err)
+}
+
+func TestNginxGatherDiagnostics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{Urls: []string{ts.URL + "/stub_status", ts.URL + "/missing"}}
+	var acc testutil.Accumulator
+	diagnostics, err := n.GatherDiagnostics(&acc)
+	require.NoError(t, err)
+	assert.True(t, acc.HasMeasurement("nginx"))
+	require.Len(t, acc.Errors, 1)
+	assert.Contains(t, acc.Errors[0].Error(), "404 Not Found")
+
+	lines := strings.Join(diagnostics, "\n")
+	assert.Contains(t, lines, ts.URL+"/stub_status: GET "+ts.URL+"/stub_status")
+	assert.Contains(t, lines, ts.URL+"/stub_status: gathered in ")
+	assert.Contains(t, lines, ts.URL+"/missing: failed: ")
+
+	_, err = (&Nginx{}).GatherDiagnostics(&acc)
+	assert.Error(t, err)
+}
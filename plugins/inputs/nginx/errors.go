@@ -0,0 +1,74 @@
+package nginx
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"net/url"
+	"sync/atomic"
+)
+
+// Phases of a gather a GatherError is reported for
+const (
+	PhaseDial       = "dial"
+	PhaseTLS        = "tls"
+	PhaseHTTPStatus = "http_status"
+	PhaseParse      = "parse"
+)
+
+// GatherError is returned for a status URL that could not be gathered.  Its
+// message is meant for humans and contains the URL, Phase can be used to
+// group the errors of many URLs.
+type GatherError struct {
+	URL   string
+	Phase string
+	Err   error
+}
+
+func (e *GatherError) Error() string {
+	return e.Err.Error()
+}
+
+// errorPhase returns the phase of err, "other" when it is not a GatherError.
+func errorPhase(err error) string {
+	if e, ok := err.(*GatherError); ok {
+		return e.Phase
+	}
+	return "other"
+}
+
+// tlsTrace records whether the last TLS handshake of the requests sent with
+// the returned context failed.  The handshake runs in the transport's own
+// goroutine, hence the atomic.
+func tlsTrace(ctx context.Context) (context.Context, *int32) {
+	failed := new(int32)
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			atomic.StoreInt32(failed, 0)
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err != nil {
+				atomic.StoreInt32(failed, 1)
+			}
+		},
+	}), failed
+}
+
+// handshakeError is returned by the DialTLS function of the transport, whose
+// TLS handshakes the client trace does not see.
+type handshakeError struct {
+	err error
+}
+
+func (e *handshakeError) Error() string {
+	return e.err.Error()
+}
+
+// isHandshakeError reports whether err of a request is a handshakeError.
+func isHandshakeError(err error) bool {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	_, ok := err.(*handshakeError)
+	return ok
+}
@@ -1,16 +1,33 @@
 package nginx
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+	"github.com/influxdata/telegraf/selfstat"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
 )
 
 const nginxSampleResponse = `
@@ -19,6 +36,12 @@ server accepts handled requests
  85340 85340 35085
 Reading: 4 Writing: 135 Waiting: 446
 `
+const nginxDroppedSampleResponse = `
+Active connections: 10
+server accepts handled requests
+ 1000 990 5000
+Reading: 1 Writing: 2 Waiting: 7
+`
 const tengineSampleResponse = `
 Active connections: 403
 server accepts handled requests request_time
@@ -32,11 +55,35 @@ func TestNginxTags(t *testing.T) {
 	var addr *url.URL
 	for _, url1 := range urls {
 		addr, _ = url.Parse(url1)
-		tagMap := getTags(addr)
+		tagMap := getTags(addr, nil)
 		assert.Contains(t, tagMap["server"], "localhost")
 	}
 }
 
+func TestNginxGetTags(t *testing.T) {
+	tests := []struct {
+		url    string
+		server string
+		port   string
+	}{
+		{"http://127.0.0.1/status", "127.0.0.1", "80"},
+		{"http://127.0.0.1:8080/status", "127.0.0.1", "8080"},
+		{"https://127.0.0.1/status", "127.0.0.1", "443"},
+		{"http://[::1]/status", "::1", "80"},
+		{"http://[::1]:8080/status", "::1", "8080"},
+		{"https://[2001:db8::1]/status", "2001:db8::1", "443"},
+		{"http://localhost/status", "localhost", "80"},
+		{"https://nginx.example.com:8443/status", "nginx.example.com", "8443"},
+		{"unix:///var/run/nginx.sock:/status", "/var/run/nginx.sock", ""},
+	}
+	for _, tt := range tests {
+		addr, err := url.Parse(tt.url)
+		require.NoError(t, err)
+		tags := getTags(addr, nil)
+		assert.Equal(t, map[string]string{"server": tt.server, "port": tt.port}, tags, tt.url)
+	}
+}
+
 func TestNginxGeneratesMetrics(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var rsp string
@@ -74,6 +121,7 @@ func TestNginxGeneratesMetrics(t *testing.T) {
 		"active":   uint64(585),
 		"accepts":  uint64(85340),
 		"handled":  uint64(85340),
+		"dropped":  uint64(0),
 		"requests": uint64(35085),
 		"reading":  uint64(4),
 		"writing":  uint64(135),
@@ -84,6 +132,7 @@ func TestNginxGeneratesMetrics(t *testing.T) {
 		"active":   uint64(403),
 		"accepts":  uint64(853),
 		"handled":  uint64(8533),
+		"dropped":  uint64(0),
 		"requests": uint64(3502),
 		"reading":  uint64(8),
 		"writing":  uint64(125),
@@ -108,6 +157,2179 @@ func TestNginxGeneratesMetrics(t *testing.T) {
 	}
 
 	tags := map[string]string{"server": host, "port": port}
-	acc_nginx.AssertContainsTaggedFields(t, "nginx", fields_nginx, tags)
-	acc_tengine.AssertContainsTaggedFields(t, "nginx", fields_tengine, tags)
+	assertStubStatusFields(t, &acc_nginx, fields_nginx, tags)
+	assertStubStatusFields(t, &acc_tengine, fields_tengine, tags)
+}
+
+// assertStubStatusFields checks the stub_status fields, which are split
+// into a counter and a gauge metric.
+func assertStubStatusFields(
+	t *testing.T,
+	acc *testutil.Accumulator,
+	fields map[string]interface{},
+	tags map[string]string,
+) {
+	counters := map[string]interface{}{}
+	gauges := map[string]interface{}{}
+	for k, v := range fields {
+		switch k {
+		case "accepts", "handled", "dropped", "requests", "request_time":
+			counters[k] = v
+		default:
+			gauges[k] = v
+		}
+	}
+
+	gathered := map[telegraf.ValueType]map[string]interface{}{}
+	for _, m := range acc.Metrics {
+		if m.Measurement == "nginx" && reflect.DeepEqual(tags, m.Tags) {
+			gathered[m.Type] = m.Fields
+		}
+	}
+	assert.Equal(t, counters, gathered[telegraf.Counter])
+	assert.Equal(t, gauges, gathered[telegraf.Gauge])
+}
+
+const vtsSampleResponse = `
+{
+    "hostName": "test.example.com",
+    "nginxVersion": "1.12.1",
+    "loadMsec": 1503378249662,
+    "nowMsec": 1503378254430,
+    "connections": {
+        "active": 2,
+        "reading": 0,
+        "writing": 1,
+        "waiting": 1,
+        "accepted": 28,
+        "handled": 28,
+        "requests": 30
+    },
+    "serverZones": {
+        "example.com": {
+            "requestCounter": 11,
+            "inBytes": 5229,
+            "outBytes": 17066,
+            "responses": {
+                "1xx": 0,
+                "2xx": 8,
+                "3xx": 1,
+                "4xx": 2,
+                "5xx": 0,
+                "miss": 0,
+                "bypass": 0,
+                "expired": 0,
+                "stale": 0,
+                "updating": 0,
+                "revalidated": 0,
+                "hit": 0,
+                "scarce": 0
+            },
+            "requestMsec": 0
+        }
+    },
+    "upstreamZones": {
+        "backend": [
+            {
+                "server": "127.0.0.1:8080",
+                "requestCounter": 10,
+                "inBytes": 3420,
+                "outBytes": 12001,
+                "responses": {
+                    "1xx": 0,
+                    "2xx": 7,
+                    "3xx": 1,
+                    "4xx": 1,
+                    "5xx": 1
+                },
+                "requestMsec": 4,
+                "responseMsec": 3,
+                "weight": 1,
+                "maxFails": 1,
+                "failTimeout": 10,
+                "backup": false,
+                "down": false
+            }
+        ]
+    },
+    "cacheZones": {
+        "static": {
+            "maxSize": 1048576,
+            "usedSize": 8192,
+            "inBytes": 512,
+            "outBytes": 2048,
+            "responses": {
+                "miss": 3,
+                "bypass": 1,
+                "expired": 0,
+                "stale": 0,
+                "updating": 0,
+                "revalidated": 0,
+                "hit": 9,
+                "scarce": 0
+            }
+        }
+    }
+}
+`
+
+func TestNginxDroppedConnections(t *testing.T) {
+	var acc testutil.Accumulator
+
+	err := gatherStubStatusUrl(bufio.NewReader(strings.NewReader(nginxDroppedSampleResponse)),
+		"nginx", map[string]string{}, false, nil, false, &acc)
+	require.NoError(t, err)
+
+	assertStubStatusFields(t, &acc,
+		map[string]interface{}{
+			"active":   uint64(10),
+			"accepts":  uint64(1000),
+			"handled":  uint64(990),
+			"dropped":  uint64(10),
+			"requests": uint64(5000),
+			"reading":  uint64(1),
+			"writing":  uint64(2),
+			"waiting":  uint64(7),
+		},
+		map[string]string{})
+}
+
+func TestNginxGeneratesVTSMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/vts_status" {
+			panic("Cannot handle request")
+		}
+		w.Header()["Content-Type"] = []string{"application/json"}
+		fmt.Fprint(w, vtsSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls: []string{fmt.Sprintf("%s/vts_status", ts.URL)},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+
+	addr, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	tags := getTags(addr, nil)
+
+	serverTags := map[string]string{"zone": "example.com"}
+	for k, v := range tags {
+		serverTags[k] = v
+	}
+	acc.AssertContainsTaggedFields(t, "nginx_vts_server",
+		map[string]interface{}{
+			"requests":      int64(11),
+			"in_bytes":      int64(5229),
+			"out_bytes":     int64(17066),
+			"responses_1xx": int64(0),
+			"responses_2xx": int64(8),
+			"responses_3xx": int64(1),
+			"responses_4xx": int64(2),
+			"responses_5xx": int64(0),
+		},
+		serverTags)
+
+	upstreamTags := map[string]string{
+		"upstream":         "backend",
+		"upstream_address": "127.0.0.1:8080",
+	}
+	for k, v := range tags {
+		upstreamTags[k] = v
+	}
+	acc.AssertContainsTaggedFields(t, "nginx_vts_upstream",
+		map[string]interface{}{
+			"requests":      int64(10),
+			"in_bytes":      int64(3420),
+			"out_bytes":     int64(12001),
+			"responses_1xx": int64(0),
+			"responses_2xx": int64(7),
+			"responses_3xx": int64(1),
+			"responses_4xx": int64(1),
+			"responses_5xx": int64(1),
+			"response_msec": int64(3),
+			"weight":        int(1),
+			"max_fails":     int(1),
+			"fail_timeout":  int(10),
+			"backup":        false,
+			"down":          false,
+		},
+		upstreamTags)
+
+	cacheTags := map[string]string{"zone": "static"}
+	for k, v := range tags {
+		cacheTags[k] = v
+	}
+	acc.AssertContainsTaggedFields(t, "nginx_vts_cache",
+		map[string]interface{}{
+			"max_size":    int64(1048576),
+			"used_size":   int64(8192),
+			"in_bytes":    int64(512),
+			"out_bytes":   int64(2048),
+			"miss":        int64(3),
+			"bypass":      int64(1),
+			"expired":     int64(0),
+			"stale":       int64(0),
+			"updating":    int64(0),
+			"revalidated": int64(0),
+			"hit":         int64(9),
+			"scarce":      int64(0),
+		},
+		cacheTags)
+}
+
+func TestNginxVTSFormatOverride(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Content-Type"] = []string{"text/plain"}
+		fmt.Fprint(w, vtsSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:   []string{ts.URL},
+		Format: "vts",
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx_vts_server"))
+	assert.False(t, acc.HasMeasurement("nginx"))
+}
+
+const tengineExtendedSampleResponse = `
+Active connections: 403
+server accepts handled requests request_time
+ 853 8533 3502 1546565864
+Reading: 8 Writing: 125 Waiting: 946
+Worker Requests: 10 Worker Connections: 4
+Request Time Avg: 0.25 Version: tengine/2.3.3
+`
+
+func TestNginxTengineFormat(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, tengineExtendedSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:   []string{ts.URL},
+		Format: "tengine",
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+
+	addr, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	assertStubStatusFields(t, &acc,
+		map[string]interface{}{
+			"active":             uint64(403),
+			"accepts":            uint64(853),
+			"handled":            uint64(8533),
+			"dropped":            uint64(0),
+			"requests":           uint64(3502),
+			"request_time":       uint64(1546565864),
+			"reading":            uint64(8),
+			"writing":            uint64(125),
+			"waiting":            uint64(946),
+			"worker_requests":    uint64(10),
+			"worker_connections": uint64(4),
+			"request_time_avg":   0.25,
+		},
+		getTags(addr, nil))
+}
+
+func TestNginxTengineFormatStandardBlock(t *testing.T) {
+	var acc testutil.Accumulator
+	err := gatherTengineStatusUrl(bufio.NewReader(strings.NewReader(nginxSampleResponse)),
+		"nginx", map[string]string{}, false, nil, false, &acc)
+	require.NoError(t, err)
+	assertStubStatusFields(t, &acc,
+		map[string]interface{}{
+			"active":   uint64(585),
+			"accepts":  uint64(85340),
+			"handled":  uint64(85340),
+			"dropped":  uint64(0),
+			"requests": uint64(35085),
+			"reading":  uint64(4),
+			"writing":  uint64(135),
+			"waiting":  uint64(446),
+		},
+		map[string]string{})
+}
+
+func TestNginxInstancePaths(t *testing.T) {
+	var conns int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/status/vts" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, vtsSampleResponse)
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	n := &Nginx{
+		Instances: []Instance{
+			{
+				URL:   fmt.Sprintf("%s/status/", ts.URL),
+				Paths: []string{"stub", "/vts"},
+				Tags:  map[string]string{"role": "edge"},
+			},
+		},
+		MaxConcurrentRequests: 1,
+	}
+	require.NoError(t, n.Init())
+	require.Len(t, n.targets, 2)
+	assert.Equal(t, "/status/stub", n.targets[0].addr.Path)
+	assert.Equal(t, "/status/vts", n.targets[1].addr.Path)
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Equal(t, "edge", acc.TagValue("nginx", "role"))
+	assert.Equal(t, "edge", acc.TagValue("nginx_vts_server", "role"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns))
+}
+
+func TestNginxJoinStatusPath(t *testing.T) {
+	tests := []struct {
+		base     string
+		path     string
+		expected string
+	}{
+		{"http://localhost", "stub_status", "http://localhost/stub_status"},
+		{"http://localhost/", "/stub_status", "http://localhost/stub_status"},
+		{"http://localhost/nginx", "vts", "http://localhost/nginx/vts"},
+		{"unix:///var/run/nginx.sock", "/stub_status", "unix:///var/run/nginx.sock:/stub_status"},
+		{"unix:///var/run/nginx.sock:/nginx/", "vts", "unix:///var/run/nginx.sock:/nginx/vts"},
+	}
+	for _, tt := range tests {
+		addr, err := url.Parse(tt.base)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, joinStatusPath(addr, tt.path).String(), tt.base)
+	}
+}
+
+func TestNginxExpectedContentType(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// As rewritten by a proxy
+		w.Header().Set("Content-Type", "application/octet-stream")
+		fmt.Fprint(w, vtsSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:                []string{ts.URL},
+		ExpectedContentType: "application/json",
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx_vts_server"))
+	assert.Equal(t, "application/octet-stream", acc.TagValue("nginx_scrape", "content_type"))
+
+	n = &Nginx{Urls: []string{ts.URL}}
+	var accDetected testutil.Accumulator
+	require.Error(t, accDetected.GatherError(n.Gather))
+	assert.False(t, accDetected.HasMeasurement("nginx_vts_server"))
+
+	n = &Nginx{Urls: []string{ts.URL}, ExpectedContentType: "text/html"}
+	assert.Error(t, n.Init())
+}
+
+func TestNginxInstanceFormat(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Content-Type"] = []string{"text/plain"}
+		if r.URL.Path == "/vts_status" {
+			fmt.Fprint(w, vtsSampleResponse)
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls: []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		Instances: []Instance{
+			{URL: fmt.Sprintf("%s/vts_status", ts.URL), Format: "vts"},
+		},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx_vts_server"))
+	assert.True(t, acc.HasMeasurement("nginx"))
+
+	n = &Nginx{
+		Instances: []Instance{{URL: "http://localhost/status", Format: "plus"}},
+	}
+	assert.Error(t, n.Init())
+
+	n = &Nginx{Urls: []string{"http://localhost/status"}, Format: "stub"}
+	assert.Error(t, n.Init())
+}
+
+const upstreamCheckSampleResponse = `
+{"servers": {
+  "total": 2,
+  "generation": 1,
+  "server": [
+    {"index": 0, "upstream": "backend", "name": "127.0.0.1:81", "status": "up", "rise": 2, "fall": 0, "type": "http", "port": 0},
+    {"index": 1, "upstream": "backend", "name": "127.0.0.1:82", "status": "down", "rise": 0, "fall": 5, "type": "http", "port": 0}
+  ]
+}}
+`
+
+func TestNginxGeneratesUpstreamCheckMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Content-Type"] = []string{"application/json"}
+		fmt.Fprint(w, upstreamCheckSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls: []string{fmt.Sprintf("%s/status?format=json", ts.URL)},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+
+	addr, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	tags := getTags(addr, nil)
+
+	upTags := map[string]string{"upstream": "backend", "name": "127.0.0.1:81"}
+	downTags := map[string]string{"upstream": "backend", "name": "127.0.0.1:82"}
+	for k, v := range tags {
+		upTags[k] = v
+		downTags[k] = v
+	}
+
+	acc.AssertContainsTaggedFields(t, "nginx_upstream_check",
+		map[string]interface{}{
+			"status":      "up",
+			"status_code": int(1),
+			"rise":        int64(2),
+			"fall":        int64(0),
+			"type":        "http",
+		},
+		upTags)
+	acc.AssertContainsTaggedFields(t, "nginx_upstream_check",
+		map[string]interface{}{
+			"status":      "down",
+			"status_code": int(0),
+			"rise":        int64(0),
+			"fall":        int64(5),
+			"type":        "http",
+		},
+		downTags)
+	assert.False(t, acc.HasMeasurement("nginx_vts_server"))
+}
+
+func TestNginxBasicAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "telegraf" || password != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:     []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		Username: "telegraf",
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx"))
+
+	n = &Nginx{
+		Urls:     []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		Username: "telegraf",
+		Password: "wrongpassword",
+	}
+	var accFail testutil.Accumulator
+	err := accFail.GatherError(n.Gather)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401")
+	assert.NotContains(t, err.Error(), "wrongpassword")
+}
+
+func TestNginxBearerTokenFile(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	tokenFile, err := ioutil.TempFile("", "nginx_token")
+	require.NoError(t, err)
+	defer os.Remove(tokenFile.Name())
+	_, err = tokenFile.WriteString("abc123\n")
+	require.NoError(t, err)
+	require.NoError(t, tokenFile.Close())
+
+	n := &Nginx{
+		Urls:            []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		BearerToken:     "ignored",
+		BearerTokenFile: tokenFile.Name(),
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx"))
+}
+
+func TestNginxUrlCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "monitor" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	addr, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	// The URL credentials take precedence over username and password
+	n := &Nginx{
+		Urls:     []string{fmt.Sprintf("http://monitor:secret@%s/stub_status", addr.Host)},
+		Username: "telegraf",
+		Password: "other",
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx"))
+	require.Len(t, n.targets, 1)
+	assert.Nil(t, n.targets[0].addr.User)
+	assert.Equal(t, getTags(addr, nil), acc.Metrics[0].Tags)
+
+	n = &Nginx{
+		Urls: []string{fmt.Sprintf("http://monitor:wrongpassword@%s/stub_status", addr.Host)},
+	}
+	var accFail testutil.Accumulator
+	err = accFail.GatherError(n.Gather)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401")
+	assert.NotContains(t, err.Error(), "wrongpassword")
+}
+
+func TestNginxOAuth2(t *testing.T) {
+	var tokenRequests int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tokenRequests, 1)
+		require.NoError(t, r.ParseForm())
+		if r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "status" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token": "token123", "token_type": "bearer", "expires_in": 3600}`)
+	}))
+	defer tokenServer.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:               []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		OAuth2ClientID:     "telegraf",
+		OAuth2ClientSecret: "secret",
+		OAuth2TokenURL:     tokenServer.URL,
+		OAuth2Scopes:       []string{"status"},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx"))
+	// The token is re-used until it expires
+	assert.Equal(t, int32(1), atomic.LoadInt32(&tokenRequests))
+
+	// A failing token request is a gather error
+	n.OAuth2Scopes = []string{"other"}
+	require.NoError(t, n.Init())
+	var accFail testutil.Accumulator
+	require.Error(t, accFail.GatherError(n.Gather))
+	assert.False(t, accFail.HasMeasurement("nginx"))
+
+	n = &Nginx{
+		Urls:           []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		OAuth2TokenURL: tokenServer.URL,
+	}
+	assert.Error(t, n.Init())
+	n.OAuth2ClientID = "telegraf"
+	n.BearerToken = "abc"
+	assert.Error(t, n.Init())
+}
+
+func TestNginxCustomHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" || r.Host != "status.example.com" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls: []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		Headers: map[string]string{
+			"X-Api-Key": "secret",
+			"Host":      "status.example.com",
+		},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx"))
+}
+
+func TestNginxCustomHeadersReplace(t *testing.T) {
+	var authorization []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header["Authorization"]
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:        []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		BearerToken: "token",
+		Headers: map[string]string{
+			"Authorization": "ApiKey secret",
+		},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Equal(t, []string{"ApiKey secret"}, authorization)
+}
+
+func TestNginxTCPKeepAlive(t *testing.T) {
+	n := &Nginx{
+		TCPKeepAlive: internal.Duration{Duration: 15 * time.Second},
+	}
+	assert.Equal(t, 15*time.Second, n.dialer().KeepAlive)
+
+	// Zero disables keep-alives instead of using the Go default
+	n = &Nginx{}
+	assert.True(t, n.dialer().KeepAlive < 0)
+
+	creator := inputs.Inputs["nginx"]
+	require.NotNil(t, creator)
+	n = creator().(*Nginx)
+	assert.Equal(t, 30*time.Second, n.TCPKeepAlive.Duration)
+}
+
+func TestNginxLocalAddress(t *testing.T) {
+	var remoteHost string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteHost, _, _ = net.SplitHostPort(r.RemoteAddr)
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:         []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		LocalAddress: "127.0.0.1",
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Equal(t, "127.0.0.1", remoteHost)
+	assert.Equal(t, "127.0.0.1:0", n.dialer().LocalAddr.String())
+
+	for _, address := range []string{"127.0.0.1:0", "[::1]:4000", "::1"} {
+		n = &Nginx{
+			Urls:         []string{"http://localhost/status"},
+			LocalAddress: address,
+		}
+		assert.NoError(t, n.Init(), address)
+	}
+	for _, address := range []string{"localhost", "127.0.0.1:http", "10.0.0.256"} {
+		n = &Nginx{
+			Urls:         []string{"http://localhost/status"},
+			LocalAddress: address,
+		}
+		assert.Error(t, n.Init(), address)
+	}
+}
+
+func TestNginxAcceptHeader(t *testing.T) {
+	// Serves JSON only when asked for it, like content negotiating builds
+	var accepts []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepts = append(accepts, r.Header.Get("Accept"))
+		if r.Header.Get("Accept") == "application/json" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, vtsSampleResponse)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{Urls: []string{ts.URL}}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx"))
+	assert.False(t, acc.HasMeasurement("nginx_vts_server"))
+
+	n = &Nginx{
+		Urls:         []string{ts.URL},
+		AcceptHeader: "application/json",
+	}
+	var accJSON testutil.Accumulator
+	require.NoError(t, accJSON.GatherError(n.Gather))
+	assert.True(t, accJSON.HasMeasurement("nginx_vts_server"))
+	assert.False(t, accJSON.HasMeasurement("nginx"))
+
+	// headers take precedence
+	n = &Nginx{
+		Urls:         []string{ts.URL},
+		AcceptHeader: "application/json",
+		Headers:      map[string]string{"Accept": "text/plain"},
+	}
+	var accHeaders testutil.Accumulator
+	require.NoError(t, accHeaders.GatherError(n.Gather))
+	assert.True(t, accHeaders.HasMeasurement("nginx"))
+	assert.Equal(t, []string{"", "application/json", "text/plain"}, accepts)
+}
+
+func TestNginxUserAgent(t *testing.T) {
+	var userAgent string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls: []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Equal(t, "Telegraf/nginx", userAgent)
+
+	n.UserAgent = "status-probe/1.0"
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Equal(t, "status-probe/1.0", userAgent)
+
+	// An explicit header takes precedence
+	n.Headers = map[string]string{"User-Agent": "from-headers"}
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Equal(t, "from-headers", userAgent)
+}
+
+func TestNginxUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, "nginx-status.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/server_status" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+
+	n := &Nginx{
+		Urls: []string{fmt.Sprintf("unix://%s:/server_status", socketPath)},
+		// Ignored for unix sockets
+		LocalAddress: "127.0.0.1",
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+
+	assertStubStatusFields(t, &acc,
+		map[string]interface{}{
+			"active":   uint64(585),
+			"accepts":  uint64(85340),
+			"handled":  uint64(85340),
+			"dropped":  uint64(0),
+			"requests": uint64(35085),
+			"reading":  uint64(4),
+			"writing":  uint64(135),
+			"waiting":  uint64(446),
+		},
+		map[string]string{"server": socketPath, "port": ""})
+}
+
+func TestNginxHTTPProxy(t *testing.T) {
+	var proxied bool
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute URL of the status page
+		proxied = r.URL.Host == "nginx.example.com"
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer proxy.Close()
+
+	n := &Nginx{
+		Urls:         []string{"http://nginx.example.com/stub_status"},
+		HTTPProxyURL: proxy.URL,
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, proxied)
+	assert.True(t, acc.HasMeasurement("nginx"))
+}
+
+func TestNginxInitInvalidProxy(t *testing.T) {
+	n := &Nginx{Urls: []string{"http://localhost/status"}, HTTPProxyURL: "ftp://proxy.example.com"}
+	assert.Error(t, n.Init())
+
+	n = &Nginx{Urls: []string{"http://localhost/status"}, HTTPProxyURL: "socks5://localhost:1080"}
+	assert.NoError(t, n.Init())
+}
+
+func TestNginxMaxBodySize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/error_page" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"serverZones": {"`+strings.Repeat("x", 4096)+`": {}}}`)
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:        []string{fmt.Sprintf("%s/error_page", ts.URL)},
+		MaxBodySize: internal.Size{Size: 1024},
+	}
+	var acc testutil.Accumulator
+	err := acc.GatherError(n.Gather)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds max_body_size of 1024 bytes")
+
+	n = &Nginx{
+		Urls:        []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		MaxBodySize: internal.Size{Size: int64(len(nginxSampleResponse))},
+	}
+	var accFits testutil.Accumulator
+	require.NoError(t, accFits.GatherError(n.Gather))
+	assert.True(t, accFits.HasMeasurement("nginx"))
+
+	n = &Nginx{
+		Urls:        []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		MaxBodySize: internal.Size{Size: -1},
+	}
+	assert.Error(t, n.Init())
+}
+
+func TestNginxHTTPMethod(t *testing.T) {
+	var method string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{Urls: []string{fmt.Sprintf("%s/stub_status", ts.URL)}}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Equal(t, "GET", method)
+
+	n = &Nginx{Urls: []string{fmt.Sprintf("%s/stub_status", ts.URL)}, HTTPMethod: "POST"}
+	var accPost testutil.Accumulator
+	require.NoError(t, accPost.GatherError(n.Gather))
+	assert.Equal(t, "POST", method)
+	assert.True(t, accPost.HasMeasurement("nginx"))
+
+	n = &Nginx{Urls: []string{fmt.Sprintf("%s/stub_status", ts.URL)}, HTTPMethod: "DELETE"}
+	assert.Error(t, n.Init())
+}
+
+func TestNginxRedirects(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stub_status":
+			fmt.Fprint(w, nginxSampleResponse)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			http.Redirect(w, r, "/stub_status", http.StatusMovedPermanently)
+		}
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:            []string{fmt.Sprintf("%s/status", ts.URL)},
+		FollowRedirects: true,
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx"))
+
+	n = &Nginx{
+		Urls:            []string{fmt.Sprintf("%s/loop", ts.URL)},
+		FollowRedirects: true,
+		MaxRedirects:    3,
+	}
+	var accLoop testutil.Accumulator
+	err := accLoop.GatherError(n.Gather)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stopped after 3 redirects")
+
+	n = &Nginx{
+		Urls: []string{fmt.Sprintf("%s/status", ts.URL)},
+	}
+	var accNoFollow testutil.Accumulator
+	err = accNoFollow.GatherError(n.Gather)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "redirecting to /stub_status")
+	assert.False(t, accNoFollow.HasMeasurement("nginx"))
+}
+
+func TestNginxHTTP2(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	require.NoError(t, http2.ConfigureServer(ts.Config, nil))
+	ts.TLS = ts.Config.TLSConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:               []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		InsecureSkipVerify: true,
+		HTTP2:              true,
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx"))
+}
+
+func TestNginxConnectionPool(t *testing.T) {
+	n := &Nginx{
+		Urls:                []string{"http://localhost/status"},
+		MaxIdleConns:        200,
+		MaxIdleConnsPerHost: 50,
+		IdleConnTimeout:     internal.Duration{Duration: time.Minute},
+	}
+	require.NoError(t, n.Init())
+
+	transport, ok := n.client.Transport.(*http.Transport)
+	require.True(t, ok)
+	assert.Equal(t, 200, transport.MaxIdleConns)
+	assert.Equal(t, 50, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+	assert.False(t, transport.DisableKeepAlives)
+
+	n = &Nginx{
+		Urls:              []string{"http://localhost/status"},
+		DisableKeepAlives: true,
+	}
+	require.NoError(t, n.Init())
+	transport, ok = n.client.Transport.(*http.Transport)
+	require.True(t, ok)
+	assert.True(t, transport.DisableKeepAlives)
+}
+
+func TestNginxDialTimeoutDefault(t *testing.T) {
+	n := &Nginx{Urls: []string{"http://localhost/status"}}
+	require.NoError(t, n.Init())
+	assert.Equal(t, 3*time.Second, n.DialTimeout.Duration)
+	assert.Equal(t, 5*time.Second, n.ResponseTimeout.Duration)
+}
+
+func TestNginxRetries(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case requests < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, nginxSampleResponse)
+		}
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:          []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		Retries:       2,
+		RetryInterval: internal.Duration{Duration: time.Millisecond},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx"))
+	assert.Equal(t, 3, requests)
+
+	// Client errors are not retried
+	requests = 0
+	n.Urls = []string{fmt.Sprintf("%s/missing", ts.URL)}
+	require.NoError(t, n.Init())
+	var accMissing testutil.Accumulator
+	require.Error(t, accMissing.GatherError(n.Gather))
+	assert.Equal(t, 1, requests)
+}
+
+func TestNginxInstanceTags(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls: []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		Instances: []Instance{
+			{
+				URL:  fmt.Sprintf("%s/edge_status", ts.URL),
+				Tags: map[string]string{"datacenter": "ams1", "role": "edge"},
+			},
+		},
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+
+	addr, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	tags := getTags(addr, nil)
+	instanceTags := getTags(addr, map[string]string{"datacenter": "ams1", "role": "edge"})
+	assert.Equal(t, "ams1", instanceTags["datacenter"])
+	assert.Equal(t, "edge", instanceTags["role"])
+	assert.Equal(t, tags["server"], instanceTags["server"])
+	assert.Equal(t, tags["port"], instanceTags["port"])
+
+	var gathered []map[string]string
+	for _, m := range acc.Metrics {
+		if m.Measurement == "nginx" {
+			gathered = append(gathered, m.Tags)
+		}
+	}
+	require.Len(t, gathered, 4)
+	assert.Contains(t, gathered, tags)
+	assert.Contains(t, gathered, instanceTags)
+}
+
+func TestNginxUrlsFile(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	urlsFile, err := ioutil.TempFile("", "nginx_urls")
+	require.NoError(t, err)
+	defer os.Remove(urlsFile.Name())
+	_, err = fmt.Fprintf(urlsFile, "# edge servers\n\n  %s/edge_status  \n\thttp://[::1/bad\n", ts.URL)
+	require.NoError(t, err)
+	require.NoError(t, urlsFile.Close())
+
+	n := &Nginx{
+		Urls:     []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		UrlsFile: urlsFile.Name(),
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, n.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+	assert.Contains(t, acc.Errors[0].Error(), "Unable to parse address")
+	assert.Contains(t, paths, "/stub_status")
+	assert.Contains(t, paths, "/edge_status")
+	assert.Len(t, paths, 2)
+
+	// Changes to the file are picked up on the next gather
+	require.NoError(t, ioutil.WriteFile(urlsFile.Name(),
+		[]byte(fmt.Sprintf("%s/other_status\n", ts.URL)), 0600))
+	paths = nil
+	var accUpdated testutil.Accumulator
+	require.NoError(t, accUpdated.GatherError(n.Gather))
+	assert.Contains(t, paths, "/stub_status")
+	assert.Contains(t, paths, "/other_status")
+	assert.Len(t, paths, 2)
+	assert.Len(t, n.targets, 1)
+
+	// A missing file is reported, the inline urls are still gathered
+	require.NoError(t, os.Remove(urlsFile.Name()))
+	paths = nil
+	var accMissing testutil.Accumulator
+	require.NoError(t, n.Gather(&accMissing))
+	require.Len(t, accMissing.Errors, 1)
+	assert.Contains(t, accMissing.Errors[0].Error(), "unable to read urls_file")
+	assert.Equal(t, []string{"/stub_status"}, paths)
+}
+
+func TestNginxMeasurementOverride(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/vts_status" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, vtsSampleResponse)
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls: []string{
+			fmt.Sprintf("%s/stub_status", ts.URL),
+			fmt.Sprintf("%s/vts_status", ts.URL),
+		},
+		Measurement: "nginx_edge",
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+
+	assert.True(t, acc.HasMeasurement("nginx_edge"))
+	assert.True(t, acc.HasMeasurement("nginx_edge_vts_server"))
+	assert.True(t, acc.HasMeasurement("nginx_edge_vts_upstream"))
+	assert.True(t, acc.HasMeasurement("nginx_edge_vts_cache"))
+	assert.False(t, acc.HasMeasurement("nginx"))
+	assert.False(t, acc.HasMeasurement("nginx_vts_server"))
+}
+
+func TestNginxScrapeResponseTime(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken_status" {
+			fmt.Fprint(w, "not a status page")
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls: []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx"))
+	assert.True(t, acc.HasFloatField("nginx_scrape", "response_time"))
+
+	n = &Nginx{
+		Urls: []string{fmt.Sprintf("%s/broken_status", ts.URL)},
+	}
+	var accBroken testutil.Accumulator
+	require.Error(t, accBroken.GatherError(n.Gather))
+	assert.False(t, accBroken.HasMeasurement("nginx"))
+	assert.True(t, accBroken.HasFloatField("nginx_scrape", "response_time"))
+}
+
+func TestNginxScrapeStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/unavailable" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	addr, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	tags := getTags(addr, nil)
+
+	n := &Nginx{
+		Urls: []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	m, ok := acc.Get("nginx_scrape")
+	require.True(t, ok)
+	// Content type detected by net/http
+	tags["content_type"] = "text/plain"
+	assert.Equal(t, tags, m.Tags)
+	assert.Equal(t, http.StatusOK, m.Fields["http_status_code"])
+	assert.Equal(t, 1, m.Fields["success"])
+
+	n = &Nginx{
+		Urls: []string{fmt.Sprintf("%s/unavailable", ts.URL)},
+	}
+	var accUnavailable testutil.Accumulator
+	require.Error(t, accUnavailable.GatherError(n.Gather))
+	assert.False(t, accUnavailable.HasMeasurement("nginx"))
+	m, ok = accUnavailable.Get("nginx_scrape")
+	require.True(t, ok)
+	assert.Equal(t, http.StatusServiceUnavailable, m.Fields["http_status_code"])
+	assert.Equal(t, 0, m.Fields["success"])
+
+	// Nothing listening, no status code
+	ts.Close()
+	n = &Nginx{
+		Urls: []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+	}
+	var accDown testutil.Accumulator
+	require.Error(t, accDown.GatherError(n.Gather))
+	m, ok = accDown.Get("nginx_scrape")
+	require.True(t, ok)
+	assert.NotContains(t, m.Fields, "http_status_code")
+	assert.Equal(t, 0, m.Fields["success"])
+}
+
+func TestNginxServerVersion(t *testing.T) {
+	tests := []struct {
+		header  string
+		version string
+	}{
+		{"nginx/1.25.3", "1.25.3"},
+		{"nginx/1.13.8 (Ubuntu)", "1.13.8"},
+		{"nginx", ""},
+		{"Apache/2.4.29", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.version, serverVersion(tt.header), tt.header)
+	}
+}
+
+func TestNginxVersionTag(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stub_status" {
+			w.Header().Set("Server", "nginx/1.25.3")
+		} else {
+			w.Header().Set("Server", "nginx")
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:             []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		GatherVersionTag: true,
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Equal(t, "1.25.3", acc.TagValue("nginx", "nginx_version"))
+	assert.Equal(t, "1.25.3", acc.TagValue("nginx_scrape", "nginx_version"))
+
+	n = &Nginx{
+		Urls:             []string{fmt.Sprintf("%s/server_tokens_off", ts.URL)},
+		GatherVersionTag: true,
+	}
+	var accNoVersion testutil.Accumulator
+	require.NoError(t, accNoVersion.GatherError(n.Gather))
+	assert.True(t, accNoVersion.HasMeasurement("nginx"))
+	assert.False(t, accNoVersion.HasTag("nginx", "nginx_version"))
+}
+
+func TestNginxUseResponseTimestamp(t *testing.T) {
+	date := time.Date(2017, 6, 1, 12, 30, 0, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stub_status" {
+			w.Header().Set("Date", date.Format(http.TimeFormat))
+		} else {
+			w.Header().Set("Date", "yesterday")
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:                 []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		UseResponseTimestamp: true,
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	for _, m := range acc.Metrics {
+		if m.Measurement == "nginx" {
+			assert.True(t, date.Equal(m.Time), "nginx metric at %s", m.Time)
+		}
+	}
+
+	n = &Nginx{
+		Urls:                 []string{fmt.Sprintf("%s/invalid_date", ts.URL)},
+		UseResponseTimestamp: true,
+	}
+	var accInvalid testutil.Accumulator
+	before := time.Now()
+	require.NoError(t, accInvalid.GatherError(n.Gather))
+	for _, m := range accInvalid.Metrics {
+		if m.Measurement == "nginx" {
+			assert.False(t, m.Time.Before(before), "nginx metric at %s", m.Time)
+		}
+	}
+}
+
+func TestNginxStubStatusSharedTimestamp(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{Urls: []string{fmt.Sprintf("%s/stub_status", ts.URL)}}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+
+	var times []time.Time
+	for _, m := range acc.Metrics {
+		if m.Measurement == "nginx" {
+			times = append(times, m.Time)
+		}
+	}
+	require.Len(t, times, 2)
+	assert.True(t, times[0].Equal(times[1]), "counters at %s, gauges at %s", times[0], times[1])
+}
+
+func TestNginxUntypedStubStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:              []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		UntypedStubStatus: true,
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+
+	var metrics []*testutil.Metric
+	for _, m := range acc.Metrics {
+		if m.Measurement == "nginx" {
+			metrics = append(metrics, m)
+		}
+	}
+	require.Len(t, metrics, 1)
+	assert.Equal(t, telegraf.Untyped, metrics[0].Type)
+	for _, field := range []string{"accepts", "handled", "requests", "dropped",
+		"active", "reading", "writing", "waiting"} {
+		assert.Contains(t, metrics[0].Fields, field)
+	}
+}
+
+func TestNginxScrapeContentType(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/error_page" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "<html><body>Welcome to nginx!</body></html>")
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{Urls: []string{fmt.Sprintf("%s/error_page", ts.URL)}}
+	var acc testutil.Accumulator
+	require.Error(t, acc.GatherError(n.Gather))
+	assert.Equal(t, "text/html", acc.TagValue("nginx_scrape", "content_type"))
+	v, ok := acc.IntField("nginx_scrape", "success")
+	require.True(t, ok)
+	assert.Equal(t, 0, v)
+
+	n = &Nginx{Urls: []string{fmt.Sprintf("%s/stub_status", ts.URL)}}
+	var accOK testutil.Accumulator
+	require.NoError(t, accOK.GatherError(n.Gather))
+	assert.Equal(t, "text/plain", accOK.TagValue("nginx_scrape", "content_type"))
+	assert.False(t, accOK.HasTag("nginx", "content_type"))
+}
+
+func TestNginxHeaderTags(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Nginx-Zone", "ams1")
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls: []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		HeaderTags: map[string]string{
+			"X-Nginx-Zone": "zone",
+			"X-Missing":    "missing",
+		},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Equal(t, "ams1", acc.TagValue("nginx", "zone"))
+	assert.Equal(t, "ams1", acc.TagValue("nginx_scrape", "zone"))
+	assert.False(t, acc.HasTag("nginx", "missing"))
+}
+
+func TestNginxFieldPrefix(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:        []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		FieldPrefix: "nginx_",
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+
+	assert.True(t, acc.HasField("nginx", "nginx_active"))
+	assert.True(t, acc.HasField("nginx", "nginx_accepts"))
+	assert.False(t, acc.HasField("nginx", "active"))
+	assert.True(t, acc.HasField("nginx_scrape", "nginx_success"))
+	for _, m := range acc.Metrics {
+		if m.Measurement == "nginx" {
+			assert.NotEqual(t, telegraf.Untyped, m.Type)
+		}
+	}
+}
+
+func TestNginxExcludePortTag(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:           []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		ExcludePortTag: true,
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasTag("nginx", "server"))
+	assert.False(t, acc.HasTag("nginx", "port"))
+	assert.False(t, acc.HasTag("nginx_scrape", "port"))
+}
+
+func TestNginxSchemeTag(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+	tlsTs := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer tlsTs.Close()
+
+	n := &Nginx{
+		Urls: []string{
+			fmt.Sprintf("%s/stub_status", ts.URL),
+			fmt.Sprintf("%s/stub_status", tlsTs.URL),
+		},
+		InsecureSkipVerify: true,
+		SchemeTag:          true,
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+
+	schemes := map[string]bool{}
+	for _, m := range acc.Metrics {
+		if m.Measurement == "nginx" {
+			schemes[m.Tags["scheme"]] = true
+		}
+	}
+	assert.Equal(t, map[string]bool{"http": true, "https": true}, schemes)
+	assert.True(t, acc.HasTag("nginx_scrape", "scheme"))
+
+	n = &Nginx{Urls: []string{fmt.Sprintf("%s/stub_status", ts.URL)}}
+	var accNoScheme testutil.Accumulator
+	require.NoError(t, accNoScheme.GatherError(n.Gather))
+	assert.False(t, accNoScheme.HasTag("nginx", "scheme"))
+}
+
+func TestNginxNormalizeHostTag(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	_, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	require.NoError(t, err)
+	address := fmt.Sprintf("http://LocalHost:%s/stub_status", port)
+
+	n := &Nginx{Urls: []string{address}, NormalizeHostTag: true}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Equal(t, "localhost", acc.TagValue("nginx", "server"))
+	assert.Equal(t, "localhost", acc.TagValue("nginx_scrape", "server"))
+
+	n = &Nginx{Urls: []string{address}}
+	var accAsIs testutil.Accumulator
+	require.NoError(t, accAsIs.GatherError(n.Gather))
+	assert.Equal(t, "LocalHost", accAsIs.TagValue("nginx", "server"))
+}
+
+func TestNginxScrapeJitter(t *testing.T) {
+	var mu sync.Mutex
+	var requested []time.Time
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, time.Now())
+		mu.Unlock()
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	var urls []string
+	for i := 0; i < 10; i++ {
+		urls = append(urls, fmt.Sprintf("%s/stub_status_%d", ts.URL, i))
+	}
+	n := &Nginx{
+		Urls:         urls,
+		ScrapeJitter: internal.Duration{Duration: 200 * time.Millisecond},
+	}
+	require.NoError(t, n.Init())
+
+	start := time.Now()
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Len(t, acc.Errors, 0)
+	require.Len(t, requested, 10)
+	first, last := requested[0], requested[0]
+	for _, r := range requested {
+		if r.Before(first) {
+			first = r
+		}
+		if r.After(last) {
+			last = r
+		}
+	}
+	assert.True(t, last.Sub(first) > 0, "requests not spread")
+	assert.True(t, last.Sub(start) < time.Second)
+
+	// Waiting requests are dropped on Stop
+	n.Stop()
+	var accStopped testutil.Accumulator
+	require.NoError(t, accStopped.GatherError(n.Gather))
+	assert.False(t, accStopped.HasMeasurement("nginx"))
+}
+
+func TestNginxOKStatusCodes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusPartialContent)
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	scrape := func(acc *testutil.Accumulator) map[string]interface{} {
+		for _, m := range acc.Metrics {
+			if m.Measurement == "nginx_scrape" {
+				return m.Fields
+			}
+		}
+		return nil
+	}
+
+	// Only 200 by default
+	n := &Nginx{Urls: []string{ts.URL}}
+	var acc testutil.Accumulator
+	require.NoError(t, n.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+	assert.Contains(t, acc.Errors[0].Error(), "206 Partial Content")
+	assert.False(t, acc.HasMeasurement("nginx"))
+	assert.Equal(t, 0, scrape(&acc)["success"])
+	assert.Equal(t, 206, scrape(&acc)["http_status_code"])
+
+	n = &Nginx{
+		Urls:          []string{ts.URL},
+		OKStatusCodes: []int{200, 206},
+	}
+	var accOK testutil.Accumulator
+	require.NoError(t, n.Gather(&accOK))
+	assert.Empty(t, accOK.Errors)
+	assert.True(t, accOK.HasMeasurement("nginx"))
+	assert.Equal(t, 1, scrape(&accOK)["success"])
+	assert.Equal(t, 206, scrape(&accOK)["http_status_code"])
+
+	n = &Nginx{
+		Urls:          []string{ts.URL},
+		OKStatusCodes: []int{2000},
+	}
+	assert.Error(t, n.Init())
+}
+
+func TestNginxCheckOnly(t *testing.T) {
+	var methods []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:      []string{ts.URL},
+		CheckOnly: true,
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Equal(t, []string{"HEAD"}, methods)
+	assert.False(t, acc.HasMeasurement("nginx"))
+	require.Len(t, acc.Metrics, 1)
+	assert.Equal(t, "nginx_scrape", acc.Metrics[0].Measurement)
+	assert.Equal(t, 1, acc.Metrics[0].Fields["success"])
+	assert.Equal(t, 200, acc.Metrics[0].Fields["http_status_code"])
+
+	n = &Nginx{
+		Urls:       []string{ts.URL},
+		CheckOnly:  true,
+		HTTPMethod: "POST",
+	}
+	assert.Error(t, n.Init())
+}
+
+func TestNginxGatherTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:          []string{ts.URL + "/slow", ts.URL + "/stub_status"},
+		GatherTimeout: internal.Duration{Duration: 200 * time.Millisecond},
+	}
+	require.NoError(t, n.Init())
+
+	start := time.Now()
+	var acc testutil.Accumulator
+	require.NoError(t, n.Gather(&acc))
+	assert.True(t, time.Since(start) < 2*time.Second)
+
+	require.Len(t, acc.Errors, 1)
+	assert.Contains(t, acc.Errors[0].Error(), "gather_timeout of 200ms exceeded")
+	assert.Contains(t, acc.Errors[0].Error(), ts.URL+"/slow")
+
+	var scrapes []interface{}
+	for _, m := range acc.Metrics {
+		if m.Measurement == "nginx_scrape" {
+			scrapes = append(scrapes, m.Fields["success"])
+		}
+	}
+	assert.ElementsMatch(t, []interface{}{0, 1}, scrapes)
+
+	n.GatherTimeout.Duration = -time.Second
+	assert.Error(t, n.Init())
+
+	// Defaults to the default interval of the agent
+	creator := inputs.Inputs["nginx"]
+	require.NotNil(t, creator)
+	n = creator().(*Nginx)
+	assert.Equal(t, 10*time.Second, n.GatherTimeout.Duration)
+}
+
+func TestNginxMaxConcurrentRequests(t *testing.T) {
+	var inFlight, maxInFlight int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{MaxConcurrentRequests: 2}
+	for i := 0; i < 10; i++ {
+		n.Urls = append(n.Urls, fmt.Sprintf("%s/stub_status/%d", ts.URL, i))
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Len(t, acc.Errors, 0)
+	assert.True(t, maxInFlight <= 2, "max in flight %d", maxInFlight)
+	var scrapes int
+	for _, m := range acc.Metrics {
+		if m.Measurement == "nginx_scrape" {
+			scrapes++
+		}
+	}
+	assert.Equal(t, 10, scrapes)
+}
+
+func TestNginxStopCancelsRequests(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:            []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		ResponseTimeout: internal.Duration{Duration: 10 * time.Second},
+		Retries:         3,
+	}
+	require.NoError(t, n.Init())
+
+	var acc testutil.Accumulator
+	done := make(chan error)
+	go func() {
+		done <- acc.GatherError(n.Gather)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	n.Stop()
+
+	select {
+	case err := <-done:
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "context canceled")
+	case <-time.After(time.Second):
+		t.Fatal("gather did not return after Stop")
+	}
+}
+
+func TestNginxComputeRatios(t *testing.T) {
+	var acc testutil.Accumulator
+	err := gatherStubStatusUrl(bufio.NewReader(strings.NewReader(nginxDroppedSampleResponse)),
+		"nginx", map[string]string{}, true, nil, false, &acc)
+	require.NoError(t, err)
+	assertStubStatusFields(t, &acc,
+		map[string]interface{}{
+			"active":                  uint64(10),
+			"accepts":                 uint64(1000),
+			"handled":                 uint64(990),
+			"dropped":                 uint64(10),
+			"requests":                uint64(5000),
+			"reading":                 uint64(1),
+			"writing":                 uint64(2),
+			"waiting":                 uint64(7),
+			"requests_per_connection": float64(5000) / float64(990),
+		},
+		map[string]string{})
+
+	// No connection handled yet
+	body := "Active connections: 0\nserver accepts handled requests\n 0 0 0\nReading: 0 Writing: 0 Waiting: 0\n"
+	var accIdle testutil.Accumulator
+	err = gatherStubStatusUrl(bufio.NewReader(strings.NewReader(body)),
+		"nginx", map[string]string{}, true, nil, false, &accIdle)
+	require.NoError(t, err)
+	value, ok := accIdle.FloatField("nginx", "requests_per_connection")
+	require.True(t, ok)
+	assert.Equal(t, float64(0), value)
+}
+
+func TestNginxMalformedStubStatus(t *testing.T) {
+	tests := []string{
+		"",
+		"Active connections: 585\n",
+		"Active connections: 585\nserver accepts handled requests\n 85340\n",
+		"Active connections: 585\nserver accepts handled requests\n 85340 85340 35085\nReading:\n",
+		"Active connections: 585\nserver accepts handled requests\n 85340 85340 35085\nReading: x Writing: 1\n",
+		"Active connections: 585\nserver accepts handled requests\n \nReading: 4 Writing: 135 Waiting: 446\n",
+		"<html><body>Bad Gateway</body></html>",
+	}
+	for _, body := range tests {
+		var acc testutil.Accumulator
+		err := gatherStubStatusUrl(bufio.NewReader(strings.NewReader(body)),
+			"nginx", map[string]string{}, false, nil, false, &acc)
+		assert.Error(t, err, body)
+		assert.False(t, acc.HasMeasurement("nginx"), body)
+	}
+}
+
+func TestNginxStubStatusMissingStates(t *testing.T) {
+	body := "Active connections: 585\nserver accepts handled requests\n 85340 85340 35085\nReading: 4 Writing: 135\n"
+
+	var acc testutil.Accumulator
+	err := gatherStubStatusUrl(bufio.NewReader(strings.NewReader(body)),
+		"nginx", map[string]string{}, false, nil, false, &acc)
+	require.NoError(t, err)
+	assertStubStatusFields(t, &acc,
+		map[string]interface{}{
+			"active":   uint64(585),
+			"accepts":  uint64(85340),
+			"handled":  uint64(85340),
+			"dropped":  uint64(0),
+			"requests": uint64(35085),
+			"reading":  uint64(4),
+			"writing":  uint64(135),
+			"waiting":  uint64(0),
+		},
+		map[string]string{})
+
+	body = "Active connections: 585\nserver accepts handled requests\n 85340 85340 35085\nWriting: 135\n"
+	var accWriting testutil.Accumulator
+	err = gatherStubStatusUrl(bufio.NewReader(strings.NewReader(body)),
+		"nginx", map[string]string{}, false, nil, false, &accWriting)
+	require.NoError(t, err)
+	assertStubStatusFields(t, &accWriting,
+		map[string]interface{}{
+			"active":   uint64(585),
+			"accepts":  uint64(85340),
+			"handled":  uint64(85340),
+			"dropped":  uint64(0),
+			"requests": uint64(35085),
+			"reading":  uint64(0),
+			"writing":  uint64(135),
+			"waiting":  uint64(0),
+		},
+		map[string]string{})
+}
+
+func TestNginxStubStatusCRLF(t *testing.T) {
+	crlf := strings.Replace(nginxSampleResponse, "\n", "\r\n", -1)
+
+	// with and without the terminator of the last line
+	for _, body := range []string{crlf, strings.TrimSuffix(crlf, "\r\n")} {
+		var acc testutil.Accumulator
+		err := gatherStubStatusUrl(bufio.NewReader(strings.NewReader(body)),
+			"nginx", map[string]string{}, false, nil, false, &acc)
+		require.NoError(t, err)
+		assertStubStatusFields(t, &acc,
+			map[string]interface{}{
+				"active":   uint64(585),
+				"accepts":  uint64(85340),
+				"handled":  uint64(85340),
+				"dropped":  uint64(0),
+				"requests": uint64(35085),
+				"reading":  uint64(4),
+				"writing":  uint64(135),
+				"waiting":  uint64(446),
+			},
+			map[string]string{})
+	}
+}
+
+func TestNginxInvalidUrl(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls: []string{"http://[::1/stub_status", fmt.Sprintf("%s/stub_status", ts.URL)},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, n.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+	assert.Contains(t, acc.Errors[0].Error(), "Unable to parse address")
+	assert.True(t, acc.HasMeasurement("nginx"))
+}
+
+func TestNginxUrlEnvExpansion(t *testing.T) {
+	require.NoError(t, os.Setenv("NGINX_TEST_STATUS_PORT", "8080"))
+	defer os.Unsetenv("NGINX_TEST_STATUS_PORT")
+	os.Unsetenv("NGINX_TEST_UNSET")
+
+	n := &Nginx{
+		Urls: []string{
+			"http://localhost:${NGINX_TEST_STATUS_PORT}/status",
+			"http://localhost:$NGINX_TEST_STATUS_PORT/other",
+		},
+	}
+	require.NoError(t, n.Init())
+	require.Len(t, n.targets, 2)
+	assert.Equal(t, "localhost:8080", n.targets[0].addr.Host)
+	assert.Equal(t, "/status", n.targets[0].addr.Path)
+	assert.Equal(t, "localhost:8080", n.targets[1].addr.Host)
+
+	n = &Nginx{
+		Urls: []string{"http://localhost:${NGINX_TEST_UNSET}/status"},
+	}
+	require.NoError(t, n.Init())
+	assert.Empty(t, n.targets)
+	var acc testutil.Accumulator
+	require.NoError(t, n.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+	assert.Contains(t, acc.Errors[0].Error(), "NGINX_TEST_UNSET not set")
+}
+
+func TestNginxUrlRangeExpansion(t *testing.T) {
+	n := &Nginx{
+		Urls: []string{
+			"http://web{08..10}:8080/status",
+			"http://db{1..2}/{status}",
+			"http://localhost/status",
+		},
+	}
+	require.NoError(t, n.Init())
+	var urls []string
+	for _, target := range n.targets {
+		urls = append(urls, target.addr.String())
+	}
+	assert.Equal(t, []string{
+		"http://web08:8080/status", "http://web09:8080/status", "http://web10:8080/status",
+		"http://db1/%7Bstatus%7D", "http://db2/%7Bstatus%7D",
+		"http://localhost/status",
+	}, urls)
+
+	expanded, err := expandRanges("http://r{1..2}s{0..1}/status")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"http://r1s0/status", "http://r1s1/status",
+		"http://r2s0/status", "http://r2s1/status",
+	}, expanded)
+
+	for _, u := range []string{
+		"http://web{10..01}/status",
+		"http://web{1..x}/status",
+		"http://web{1..}/status",
+		"http://web{1..2..3}/status",
+		"http://web{-1..2}/status",
+		"http://web{0..99999}/status",
+	} {
+		n := &Nginx{Urls: []string{u, "http://localhost/status"}}
+		require.NoError(t, n.Init(), u)
+		assert.Len(t, n.targets, 1, u)
+		assert.Len(t, n.urlErrors, 1, u)
+	}
+}
+
+func TestNginxInitValidation(t *testing.T) {
+	n := &Nginx{}
+	assert.Error(t, n.Init())
+
+	n = &Nginx{
+		Urls:    []string{"http://localhost/status"},
+		SSLCert: "/etc/telegraf/cert.pem",
+	}
+	assert.Error(t, n.Init())
+
+	n = &Nginx{
+		Urls:            []string{"http://localhost/status"},
+		ResponseTimeout: internal.Duration{Duration: -time.Second},
+	}
+	assert.Error(t, n.Init())
+
+	n = &Nginx{
+		Instances: []Instance{{URL: "http://localhost/status"}},
+	}
+	require.NoError(t, n.Init())
+	require.Len(t, n.targets, 1)
+	assert.Equal(t, "localhost", n.targets[0].addr.Host)
+}
+
+func TestNginxGzipResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gzip", r.Header.Get("Accept-Encoding"))
+		body := nginxSampleResponse
+		if r.URL.Path == "/vts_status" {
+			w.Header().Set("Content-Type", "application/json")
+			body = vtsSampleResponse
+		}
+		if r.URL.Path == "/plain_status" {
+			fmt.Fprint(w, body)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, body)
+		gz.Close()
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls: []string{
+			fmt.Sprintf("%s/stub_status", ts.URL),
+			fmt.Sprintf("%s/vts_status", ts.URL),
+			fmt.Sprintf("%s/plain_status", ts.URL),
+		},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Len(t, acc.Errors, 0)
+	assert.True(t, acc.HasMeasurement("nginx"))
+	assert.True(t, acc.HasMeasurement("nginx_vts_server"))
+
+	var gathered int
+	for _, m := range acc.Metrics {
+		if m.Measurement == "nginx" && m.Type == telegraf.Gauge {
+			gathered++
+		}
+	}
+	assert.Equal(t, 2, gathered)
+}
+
+func TestNginxGzipResponseEncodingCase(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "GZIP")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, nginxSampleResponse)
+		gz.Close()
+	}))
+	defer ts.Close()
+
+	n := &Nginx{Urls: []string{fmt.Sprintf("%s/stub_status", ts.URL)}}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+
+	addr, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	assertStubStatusFields(t, &acc,
+		map[string]interface{}{
+			"active":   uint64(585),
+			"accepts":  uint64(85340),
+			"handled":  uint64(85340),
+			"dropped":  uint64(0),
+			"requests": uint64(35085),
+			"reading":  uint64(4),
+			"writing":  uint64(135),
+			"waiting":  uint64(446),
+		},
+		getTags(addr, nil))
+}
+
+func TestNginxSelfStats(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls: []string{
+			fmt.Sprintf("%s/stub_status", ts.URL),
+			fmt.Sprintf("%s/missing", ts.URL),
+		},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, n.Gather(&acc))
+	require.NoError(t, n.Gather(&acc))
+
+	addr, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	tags := getTags(addr, nil)
+
+	var found bool
+	for _, m := range selfstat.Metrics() {
+		if m.Name() != "internal_nginx" || !reflect.DeepEqual(m.Tags(), tags) {
+			continue
+		}
+		found = true
+		fields := m.Fields()
+		assert.Equal(t, int64(4), fields["gathers"])
+		assert.Equal(t, int64(2), fields["gather_errors"])
+		assert.Contains(t, fields, "gather_time_ns")
+	}
+	assert.True(t, found)
+}
+
+func TestNginxErrorPhases(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			fmt.Fprint(w, "Active connections: lots\n")
+		}
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+	closed := httptest.NewServer(handler)
+	closed.Close()
+
+	phases := map[string]string{
+		closed.URL + "/stub_status":    PhaseDial,
+		tlsServer.URL + "/stub_status": PhaseTLS,
+		ts.URL + "/missing":            PhaseHTTPStatus,
+		ts.URL + "/stub_status":        PhaseParse,
+	}
+	n := &Nginx{}
+	for u := range phases {
+		n.Urls = append(n.Urls, u)
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, n.Gather(&acc))
+
+	require.Len(t, acc.Errors, len(phases))
+	for _, err := range acc.Errors {
+		gatherErr, ok := err.(*GatherError)
+		require.True(t, ok, "unexpected error type %T", err)
+		assert.Equal(t, phases[gatherErr.URL], gatherErr.Phase, gatherErr.URL)
+		assert.Contains(t, gatherErr.Error(), gatherErr.URL)
+	}
+
+	counted := map[string]bool{}
+	for _, m := range selfstat.Metrics() {
+		if m.Name() == "internal_nginx" && m.Tags()["phase"] != "" {
+			assert.Len(t, m.Tags(), 1)
+			counted[m.Tags()["phase"]] = m.Fields()["errors"].(int64) > 0
+		}
+	}
+	for _, phase := range phases {
+		assert.True(t, counted[phase], phase)
+	}
+}
+
+func TestNginxLogResponse(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Active connections: lots\n")
+		fmt.Fprint(w, strings.Repeat("x", 2*logResponseMaxBytes))
+	}))
+	defer ts.Close()
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	n := &Nginx{
+		Urls:        []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		LogResponse: true,
+	}
+	var acc testutil.Accumulator
+	require.Error(t, acc.GatherError(n.Gather))
+	assert.Contains(t, logged.String(), `"Active connections: lots\nxxx`)
+	assert.NotContains(t, logged.String(), strings.Repeat("x", logResponseMaxBytes))
+
+	logged.Reset()
+	n.LogResponse = false
+	require.Error(t, acc.GatherError(n.Gather))
+	assert.NotContains(t, logged.String(), "Active connections")
+}
+
+func TestNginxHeadBuffer(t *testing.T) {
+	b := &headBuffer{max: 5}
+	fmt.Fprint(b, "abc")
+	fmt.Fprint(b, "defgh")
+	fmt.Fprint(b, "ijk")
+	assert.Equal(t, "abcde", string(b.Bytes()))
+}
+
+func BenchmarkNginxGatherResponse(b *testing.B) {
+	n := &Nginx{}
+	addr := &url.URL{Scheme: "http", Host: "localhost", Path: "/stub_status"}
+	header := http.Header{}
+	tags := map[string]string{}
+	acc := testutil.Accumulator{Discard: true}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := n.gatherResponse(addr, "", header, strings.NewReader(nginxSampleResponse),
+			"nginx", tags, &acc)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
 }
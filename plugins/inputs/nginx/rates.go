@@ -0,0 +1,44 @@
+package nginx
+
+import (
+	"sync"
+	"time"
+)
+
+// counterRates keeps the stub_status counters of the previous gather of
+// every URL to derive per second rates from.
+type counterRates struct {
+	mu   sync.Mutex
+	last map[string]counterSample
+}
+
+type counterSample struct {
+	accepts  uint64
+	requests uint64
+	time     time.Time
+}
+
+func newCounterRates() *counterRates {
+	return &counterRates{last: make(map[string]counterSample)}
+}
+
+// update stores the counters of url and returns the rate fields since the
+// previous gather.  No rates are returned on the first gather and when a
+// counter went backwards, as it does when nginx restarts.
+func (c *counterRates) update(url string, accepts, requests uint64, now time.Time) map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last, ok := c.last[url]
+	c.last[url] = counterSample{accepts: accepts, requests: requests, time: now}
+	if !ok || accepts < last.accepts || requests < last.requests {
+		return nil
+	}
+	elapsed := now.Sub(last.time).Seconds()
+	if elapsed <= 0 {
+		return nil
+	}
+	return map[string]interface{}{
+		"accepts_per_sec":  float64(accepts-last.accepts) / elapsed,
+		"requests_per_sec": float64(requests-last.requests) / elapsed,
+	}
+}
@@ -0,0 +1,69 @@
+package nginx
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterRates(t *testing.T) {
+	c := newCounterRates()
+	now := time.Now()
+
+	assert.Nil(t, c.update("http://localhost/status", 100, 1000, now))
+
+	now = now.Add(10 * time.Second)
+	assert.Equal(t,
+		map[string]interface{}{
+			"accepts_per_sec":  float64(5),
+			"requests_per_sec": float64(50),
+		},
+		c.update("http://localhost/status", 150, 1500, now))
+
+	// Other URLs are tracked separately
+	assert.Nil(t, c.update("http://localhost/other", 1, 1, now))
+
+	// nginx restarted
+	now = now.Add(10 * time.Second)
+	assert.Nil(t, c.update("http://localhost/status", 10, 20, now))
+	now = now.Add(10 * time.Second)
+	assert.Equal(t,
+		map[string]interface{}{
+			"accepts_per_sec":  float64(1),
+			"requests_per_sec": float64(2),
+		},
+		c.update("http://localhost/status", 20, 40, now))
+}
+
+func TestNginxComputeRates(t *testing.T) {
+	var gathers int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := atomic.AddInt32(&gathers, 1)
+		fmt.Fprintf(w, "Active connections: 1\nserver accepts handled requests\n %d %d %d\nReading: 0 Writing: 1 Waiting: 0\n",
+			100*i, 100*i, 1000*i)
+	}))
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:         []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		ComputeRates: true,
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.False(t, acc.HasField("nginx", "requests_per_sec"))
+
+	time.Sleep(10 * time.Millisecond)
+	var accRates testutil.Accumulator
+	require.NoError(t, accRates.GatherError(n.Gather))
+	assert.True(t, accRates.HasFloatField("nginx", "accepts_per_sec"))
+	requestsPerSec, ok := accRates.FloatField("nginx", "requests_per_sec")
+	require.True(t, ok)
+	assert.True(t, requestsPerSec > 0)
+}
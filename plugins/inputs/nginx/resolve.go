@@ -0,0 +1,70 @@
+package nginx
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Time allowed for resolving a host for the ip tag
+const resolveTimeout = 5 * time.Second
+
+// hostCache resolves host names to an address and keeps successful results
+// for ttl, so the status hosts are not looked up again on every gather.
+type hostCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedHost
+	// net.DefaultResolver.LookupIPAddr, replaced by tests
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+type cachedHost struct {
+	ip      string
+	expires time.Time
+}
+
+func newHostCache(ttl time.Duration) *hostCache {
+	return &hostCache{
+		ttl:     ttl,
+		entries: make(map[string]cachedHost),
+		lookup:  net.DefaultResolver.LookupIPAddr,
+	}
+}
+
+// resolve returns the address of host, preferring IPv4.  Failed lookups are
+// not cached and return false.
+func (c *hostCache) resolve(ctx context.Context, host string) (string, bool) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), true
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.ip, true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	addrs, err := c.lookup(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return "", false
+	}
+	ip := addrs[0].IP
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			ip = addr.IP
+			break
+		}
+	}
+
+	if c.ttl > 0 {
+		c.mu.Lock()
+		c.entries[host] = cachedHost{ip: ip.String(), expires: time.Now().Add(c.ttl)}
+		c.mu.Unlock()
+	}
+	return ip.String(), true
+}
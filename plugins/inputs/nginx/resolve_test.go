@@ -0,0 +1,105 @@
+package nginx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostCacheResolve(t *testing.T) {
+	lookups := 0
+	c := newHostCache(time.Minute)
+	c.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		lookups++
+		switch host {
+		case "nginx.example.com":
+			return []net.IPAddr{
+				{IP: net.ParseIP("2001:db8::1")},
+				{IP: net.ParseIP("192.0.2.1")},
+			}, nil
+		case "v6.example.com":
+			return []net.IPAddr{{IP: net.ParseIP("2001:db8::2")}}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	ip, ok := c.resolve(context.Background(), "nginx.example.com")
+	require.True(t, ok)
+	assert.Equal(t, "192.0.2.1", ip)
+	ip, ok = c.resolve(context.Background(), "nginx.example.com")
+	require.True(t, ok)
+	assert.Equal(t, "192.0.2.1", ip)
+	assert.Equal(t, 1, lookups)
+
+	ip, ok = c.resolve(context.Background(), "v6.example.com")
+	require.True(t, ok)
+	assert.Equal(t, "2001:db8::2", ip)
+
+	// Failures are not cached
+	_, ok = c.resolve(context.Background(), "missing.example.com")
+	assert.False(t, ok)
+	_, ok = c.resolve(context.Background(), "missing.example.com")
+	assert.False(t, ok)
+	assert.Equal(t, 4, lookups)
+
+	// Addresses are not looked up
+	ip, ok = c.resolve(context.Background(), "192.0.2.7")
+	require.True(t, ok)
+	assert.Equal(t, "192.0.2.7", ip)
+	assert.Equal(t, 4, lookups)
+}
+
+func TestHostCacheExpiry(t *testing.T) {
+	lookups := 0
+	c := newHostCache(0)
+	c.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		lookups++
+		return []net.IPAddr{{IP: net.ParseIP("192.0.2.1")}}, nil
+	}
+
+	c.resolve(context.Background(), "nginx.example.com")
+	c.resolve(context.Background(), "nginx.example.com")
+	assert.Equal(t, 2, lookups)
+}
+
+func TestNginxResolveHostTag(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	_, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	require.NoError(t, err)
+
+	n := &Nginx{
+		Urls:           []string{fmt.Sprintf("http://localhost:%s/stub_status", port)},
+		ResolveHostTag: true,
+	}
+	require.NoError(t, n.Init())
+	n.hosts.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("192.0.2.1")}}, nil
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Equal(t, "192.0.2.1", acc.TagValue("nginx", "ip"))
+	assert.Equal(t, "192.0.2.1", acc.TagValue("nginx_scrape", "ip"))
+	assert.Equal(t, "localhost", acc.TagValue("nginx", "server"))
+
+	n.hosts.entries = map[string]cachedHost{}
+	n.hosts.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return nil, errors.New("no such host")
+	}
+	var accFailed testutil.Accumulator
+	require.NoError(t, accFailed.GatherError(n.Gather))
+	assert.True(t, accFailed.HasMeasurement("nginx"))
+	assert.False(t, accFailed.HasTag("nginx", "ip"))
+}
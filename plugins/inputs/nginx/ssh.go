@@ -0,0 +1,408 @@
+package nginx
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// SSHTunnel configures an SSH server, e.g. a bastion host, the status pages
+// are reached through.
+type SSHTunnel struct {
+	// Address of the SSH server, port 22 is used when it has none
+	Host string `toml:"host"`
+	User string `toml:"user"`
+	// Private key, the keys of the SSH agent are used when it is not set
+	KeyFile       string `toml:"key_file"`
+	KeyPassphrase string `toml:"key_passphrase"`
+	// Keys of the SSH server, defaults to ~/.ssh/known_hosts
+	KnownHostsFile string `toml:"known_hosts_file"`
+}
+
+// createSSHTunnel prepares the SSH client configuration, the connection is
+// opened by the first request.
+func (n *Nginx) createSSHTunnel(dialer *net.Dialer) (*sshTunnel, error) {
+	cfg := n.SSHTunnel
+	if cfg.Host == "" || cfg.User == "" {
+		return nil, errors.New("ssh_tunnel requires host and user")
+	}
+	addr := cfg.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+
+	knownHostsFile := cfg.KnownHostsFile
+	if knownHostsFile == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			u, err := user.Current()
+			if err != nil {
+				return nil, fmt.Errorf("could not find ssh_tunnel known_hosts_file: %s", err)
+			}
+			home = u.HomeDir
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := loadKnownHosts(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load ssh_tunnel known_hosts_file: %s", err)
+	}
+
+	t := &sshTunnel{addr: addr, dialer: dialer, done: make(chan struct{})}
+	var auth ssh.AuthMethod
+	if cfg.KeyFile != "" {
+		key, err := ioutil.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read ssh_tunnel key_file: %s", err)
+		}
+		signer, err := parsePrivateKey(key, cfg.KeyPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse ssh_tunnel key_file: %s", err)
+		}
+		auth = ssh.PublicKeys(signer)
+	} else {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, errors.New("ssh_tunnel requires key_file when no SSH agent is running")
+		}
+		// Kept open to sign the authentication of every reconnect
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to the SSH agent: %s", err)
+		}
+		t.agent = conn
+		auth = ssh.PublicKeysCallback(agent.NewClient(conn).Signers)
+	}
+
+	t.config = &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+	}
+	return t, nil
+}
+
+// parsePrivateKey parses a PEM encoded private key, decrypting it with
+// passphrase when it is set.
+func parsePrivateKey(key []byte, passphrase string) (ssh.Signer, error) {
+	if passphrase == "" {
+		return ssh.ParsePrivateKey(key)
+	}
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+	der, err := x509.DecryptPEMBlock(block, []byte(passphrase))
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}))
+}
+
+// knownHost is a key of a known_hosts file with the host patterns it is
+// listed for.
+type knownHost struct {
+	patterns []string
+	key      []byte
+	revoked  bool
+}
+
+// loadKnownHosts returns a host key callback that accepts the keys file
+// lists for the host, plain and hashed host names are supported.
+// Certificate authorities are not.  The knownhosts package is newer than the
+// x/crypto revision in Godeps.
+func loadKnownHosts(file string) (func(string, net.Addr, ssh.PublicKey) error, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []knownHost
+	for {
+		marker, patterns, key, _, rest, err := ssh.ParseKnownHosts(data)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data = rest
+		if marker != "" && marker != "revoked" {
+			continue
+		}
+		hosts = append(hosts, knownHost{
+			patterns: patterns,
+			key:      key.Marshal(),
+			revoked:  marker == "revoked",
+		})
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		name := knownHostName(hostname)
+		known := false
+		for _, h := range hosts {
+			if !bytes.Equal(h.key, key.Marshal()) || !h.matches(name) {
+				continue
+			}
+			if h.revoked {
+				return fmt.Errorf("host key of %s is revoked in %s", hostname, file)
+			}
+			known = true
+		}
+		if !known {
+			return fmt.Errorf("host key of %s is not listed in %s", hostname, file)
+		}
+		return nil
+	}, nil
+}
+
+// knownHostName returns the name address is listed with in known_hosts,
+// the port is only part of it when it is not 22.
+func knownHostName(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return strings.ToLower(address)
+	}
+	host = strings.ToLower(host)
+	if port == "22" {
+		return host
+	}
+	return "[" + host + "]:" + port
+}
+
+func (h knownHost) matches(name string) bool {
+	matched := false
+	for _, pattern := range h.patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		if negated {
+			pattern = pattern[1:]
+		}
+		if !matchKnownHost(pattern, name) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// matchKnownHost matches name against a host pattern of known_hosts, which
+// is either hashed ("|1|salt|hash") or may contain the wildcards * and ?.
+func matchKnownHost(pattern, name string) bool {
+	if strings.HasPrefix(pattern, "|1|") {
+		parts := strings.Split(pattern[3:], "|")
+		if len(parts) != 2 {
+			return false
+		}
+		salt, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return false
+		}
+		hash, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(name))
+		return hmac.Equal(mac.Sum(nil), hash)
+	}
+	return matchWildcard(strings.ToLower(pattern), name)
+}
+
+func matchWildcard(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchWildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+// sshTunnel dials connections through one SSH connection shared by all
+// status URLs.  The SSH connection is re-established when it breaks.
+type sshTunnel struct {
+	addr   string
+	config *ssh.ClientConfig
+	dialer *net.Dialer
+	agent  net.Conn
+
+	// Closed by Close to abort the dials in progress
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+func (t *sshTunnel) connect(ctx context.Context) (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	conn, err := t.dialer.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to ssh_tunnel host %s: %s", t.addr, err)
+	}
+	// The handshake is bounded by dial_timeout as well
+	if t.dialer.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(t.dialer.Timeout))
+	}
+	cancelled := t.closeOnDone(ctx, conn)
+	c, chans, reqs, err := ssh.NewClientConn(conn, t.addr, t.config)
+	if cancelled() {
+		if err == nil {
+			c.Close()
+		}
+		return nil, t.abortErr(ctx)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ssh_tunnel handshake with %s failed: %s", t.addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	t.client = ssh.NewClient(c, chans, reqs)
+	return t.client, nil
+}
+
+// closeOnDone closes conn when ctx is done or the tunnel is closed before
+// the returned function is called, which reports whether it was closed.
+func (t *sshTunnel) closeOnDone(ctx context.Context, conn net.Conn) func() bool {
+	done := make(chan struct{})
+	closed := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			closed <- true
+		case <-t.done:
+			conn.Close()
+			closed <- true
+		case <-done:
+			closed <- false
+		}
+	}()
+	return func() bool {
+		close(done)
+		return <-closed
+	}
+}
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// dial opens a connection to address from the SSH server.  When ctx is done
+// or the tunnel is closed first, the connection is closed as soon as it is
+// opened.
+func (t *sshTunnel) dial(ctx context.Context, client *ssh.Client, network, address string) (net.Conn, error) {
+	result := make(chan dialResult, 1)
+	go func() {
+		conn, err := client.Dial(network, address)
+		result <- dialResult{conn, err}
+	}()
+	select {
+	case r := <-result:
+		return r.conn, r.err
+	case <-ctx.Done():
+	case <-t.done:
+	}
+	go func() {
+		if r := <-result; r.conn != nil {
+			r.conn.Close()
+		}
+	}()
+	return nil, t.abortErr(ctx)
+}
+
+var errTunnelClosed = errors.New("ssh_tunnel closed")
+
+// abortErr returns the reason a dial was aborted.
+func (t *sshTunnel) abortErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errTunnelClosed
+}
+
+// DialContext opens a connection to address from the SSH server.  A broken
+// SSH connection is replaced once before giving up.
+func (t *sshTunnel) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	for attempt := 0; ; attempt++ {
+		client, err := t.connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := t.dial(ctx, client, network, address)
+		if err == nil {
+			return conn, nil
+		}
+		if err == ctx.Err() || err == errTunnelClosed {
+			return nil, err
+		}
+		// A connection refused by the SSH server leaves the tunnel usable
+		if _, ok := err.(*ssh.OpenChannelError); ok || attempt > 0 {
+			return nil, fmt.Errorf("ssh_tunnel could not connect to %s: %s", address, err)
+		}
+		t.reset(client)
+	}
+}
+
+// reset drops client unless another request replaced it already.
+func (t *sshTunnel) reset(client *ssh.Client) {
+	t.mu.Lock()
+	if t.client == client {
+		t.client = nil
+	}
+	t.mu.Unlock()
+	client.Close()
+}
+
+func (t *sshTunnel) Close() {
+	t.closeOnce.Do(func() { close(t.done) })
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		t.client.Close()
+		t.client = nil
+	}
+	if t.agent != nil {
+		t.agent.Close()
+	}
+}
@@ -0,0 +1,335 @@
+package nginx
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshServer forwards the direct-tcpip channels of the clients that
+// authenticate with clientKey.  It returns its listener and the number of
+// SSH connections it accepted.
+func sshServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) (net.Listener, *int32) {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if c.User() == "telegraf" && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", c.User())
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	var conns int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&conns, 1)
+			go serveSSH(conn, config)
+		}
+	}()
+	return listener, &conns
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		var target struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if newChannel.ChannelType() != "direct-tcpip" ||
+			ssh.Unmarshal(newChannel.ExtraData(), &target) != nil {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel")
+			continue
+		}
+		upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, fmt.Sprint(target.Port)))
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			upstream.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go func() {
+			io.Copy(channel, upstream)
+			channel.CloseWrite()
+		}()
+		go func() {
+			io.Copy(upstream, channel)
+			upstream.Close()
+		}()
+	}
+}
+
+// knownHostsLine returns the known_hosts line of the SSH server at address.
+func knownHostsLine(address string, key ssh.PublicKey) string {
+	return knownHostName(address) + " " + string(ssh.MarshalAuthorizedKey(key))
+}
+
+func TestNginxSSHTunnel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	hostPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	hostKey, err := ssh.NewSignerFromKey(hostPrivate)
+	require.NoError(t, err)
+	clientPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	clientKey, err := ssh.NewPublicKey(&clientPrivate.PublicKey)
+	require.NoError(t, err)
+
+	listener, conns := sshServer(t, hostKey, clientKey)
+	defer listener.Close()
+
+	dir, err := ioutil.TempDir("", "nginx_ssh")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "id_ecdsa")
+	der, err := x509.MarshalECPrivateKey(clientPrivate)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600))
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	require.NoError(t, ioutil.WriteFile(knownHostsFile, []byte(knownHostsLine(
+		listener.Addr().String(), hostKey.PublicKey())), 0600))
+
+	n := &Nginx{
+		Urls: []string{ts.URL + "/status", ts.URL + "/other"},
+		SSHTunnel: &SSHTunnel{
+			Host:           listener.Addr().String(),
+			User:           "telegraf",
+			KeyFile:        keyFile,
+			KnownHostsFile: knownHostsFile,
+		},
+		DisableKeepAlives: true,
+	}
+	require.NoError(t, n.Init())
+	defer n.Stop()
+
+	var acc testutil.Accumulator
+	require.NoError(t, n.Gather(&acc))
+	assert.Empty(t, acc.Errors)
+	assert.True(t, acc.HasMeasurement("nginx"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(conns))
+
+	// A broken SSH connection is replaced
+	n.tunnel.client.Close()
+	var accReconnected testutil.Accumulator
+	require.NoError(t, n.Gather(&accReconnected))
+	assert.Empty(t, accReconnected.Errors)
+	assert.True(t, accReconnected.HasMeasurement("nginx"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(conns))
+
+	// The key of the server must be known
+	require.NoError(t, ioutil.WriteFile(knownHostsFile, []byte(knownHostsLine(
+		listener.Addr().String(), clientKey)), 0600))
+	n = &Nginx{
+		Urls: []string{ts.URL + "/status"},
+		SSHTunnel: &SSHTunnel{
+			Host:           listener.Addr().String(),
+			User:           "telegraf",
+			KeyFile:        keyFile,
+			KnownHostsFile: knownHostsFile,
+		},
+	}
+	require.NoError(t, n.Init())
+	defer n.Stop()
+	var accUnknownHost testutil.Accumulator
+	require.NoError(t, n.Gather(&accUnknownHost))
+	require.Len(t, accUnknownHost.Errors, 1)
+	assert.Contains(t, accUnknownHost.Errors[0].Error(), "ssh_tunnel handshake")
+}
+
+func TestNginxSSHTunnelInit(t *testing.T) {
+	n := &Nginx{
+		Urls:      []string{"http://localhost/status"},
+		SSHTunnel: &SSHTunnel{Host: "bastion.example.com"},
+	}
+	assert.Error(t, n.Init())
+
+	n = &Nginx{
+		Urls: []string{"http://localhost/status"},
+		SSHTunnel: &SSHTunnel{
+			Host:           "bastion.example.com",
+			User:           "telegraf",
+			KeyFile:        "/nonexistent/id_ecdsa",
+			KnownHostsFile: "/nonexistent/known_hosts",
+		},
+	}
+	assert.Error(t, n.Init())
+}
+
+func TestNginxSSHKnownHosts(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	key, err := ssh.NewPublicKey(&private.PublicKey)
+	require.NoError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ssh.NewPublicKey(&other.PublicKey)
+	require.NoError(t, err)
+	authorizedKey := string(ssh.MarshalAuthorizedKey(key))
+
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte("[hashed.example.com]:2222"))
+	hashed := "|1|" + base64.StdEncoding.EncodeToString(salt) + "|" +
+		base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	dir, err := ioutil.TempDir("", "nginx_ssh")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "known_hosts")
+	require.NoError(t, ioutil.WriteFile(file, []byte(
+		"# comment\n"+
+			"bastion.example.com,10.0.0.1 "+authorizedKey+
+			"*.example.org,!internal.example.org "+authorizedKey+
+			hashed+" "+authorizedKey+
+			"@revoked revoked.example.com "+authorizedKey+
+			"revoked.example.com "+authorizedKey), 0600))
+	callback, err := loadKnownHosts(file)
+	require.NoError(t, err)
+
+	for _, host := range []string{
+		"bastion.example.com:22", "BASTION.example.com:22", "10.0.0.1:22",
+		"a.example.org:22", "hashed.example.com:2222",
+	} {
+		assert.NoError(t, callback(host, nil, key), host)
+	}
+	for _, host := range []string{
+		"bastion.example.com:2222", "internal.example.org:22",
+		"hashed.example.com:22", "revoked.example.com:22", "unknown.example.com:22",
+	} {
+		assert.Error(t, callback(host, nil, key), host)
+	}
+	assert.Error(t, callback("bastion.example.com:22", nil, otherKey))
+}
+
+func TestNginxSSHTunnelKeyPassphrase(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(private)
+	require.NoError(t, err)
+	block, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", der,
+		[]byte("secret"), x509.PEMCipherAES256)
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "nginx_ssh")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "id_ecdsa")
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(block), 0600))
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	require.NoError(t, ioutil.WriteFile(knownHostsFile, nil, 0600))
+
+	tunnel := &SSHTunnel{
+		Host:           "bastion.example.com",
+		User:           "telegraf",
+		KeyFile:        keyFile,
+		KeyPassphrase:  "secret",
+		KnownHostsFile: knownHostsFile,
+	}
+	n := &Nginx{Urls: []string{"http://localhost/status"}, SSHTunnel: tunnel}
+	require.NoError(t, n.Init())
+	n.Stop()
+
+	tunnel.KeyPassphrase = "wrong"
+	n = &Nginx{Urls: []string{"http://localhost/status"}, SSHTunnel: tunnel}
+	assert.Error(t, n.Init())
+}
+
+func TestNginxSSHTunnelGatherTimeout(t *testing.T) {
+	// An SSH server that never answers the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	dir, err := ioutil.TempDir("", "nginx_ssh")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	keyFile := filepath.Join(dir, "id_ecdsa")
+	require.NoError(t, ioutil.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600))
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	require.NoError(t, ioutil.WriteFile(knownHostsFile, nil, 0600))
+
+	n := &Nginx{
+		Urls: []string{"http://nginx.example.com/status"},
+		SSHTunnel: &SSHTunnel{
+			Host:           listener.Addr().String(),
+			User:           "telegraf",
+			KeyFile:        keyFile,
+			KnownHostsFile: knownHostsFile,
+		},
+		DialTimeout:     internal.Duration{Duration: time.Minute},
+		ResponseTimeout: internal.Duration{Duration: time.Minute},
+		GatherTimeout:   internal.Duration{Duration: 100 * time.Millisecond},
+	}
+	require.NoError(t, n.Init())
+	defer n.Stop()
+
+	start := time.Now()
+	var acc testutil.Accumulator
+	require.NoError(t, n.Gather(&acc))
+	assert.Len(t, acc.Errors, 1)
+
+	// Stop aborts the handshake if the request did not
+	n.Stop()
+	n.tunnel.mu.Lock()
+	n.tunnel.mu.Unlock()
+	assert.True(t, time.Since(start) < 10*time.Second)
+}
@@ -0,0 +1,465 @@
+package nginx
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"golang.org/x/crypto/pkcs12"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+}
+
+// The cipher suites implemented by crypto/tls, by their Go name
+var tlsCipherSuites = map[string]uint16{
+	"TLS_RSA_WITH_RC4_128_SHA":                tls.TLS_RSA_WITH_RC4_128_SHA,
+	"TLS_RSA_WITH_3DES_EDE_CBC_SHA":           tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_CBC_SHA256":         tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_RC4_128_SHA":        tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_RC4_128_SHA":          tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA,
+	"TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA":     tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":    tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":  tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+}
+
+// parseCipherSuites maps Go cipher suite names to their IDs.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := tlsCipherSuites[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite '%s'", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// hasInlineTLS reports whether any of the tls_*_pem options is set.
+func (n *Nginx) hasInlineTLS() bool {
+	return n.TLSCertPEM != "" || n.TLSKeyPEM != "" || n.TLSCAPEM != ""
+}
+
+// createTLSConfig builds the client TLS configuration from the ssl_* files
+// and the tls_* options.  It returns nil when no TLS option is set.
+func (n *Nginx) createTLSConfig() (*tls.Config, error) {
+	if (n.TLSCertPEM == "") != (n.TLSKeyPEM == "") {
+		return nil, errors.New("tls_cert_pem and tls_key_pem must be set together")
+	}
+	if n.TLSPKCS12File != "" && (n.SSLCert != "" || n.TLSCertPEM != "") {
+		return nil, errors.New("tls_pkcs12_file cannot be combined with " +
+			"ssl_cert or tls_cert_pem")
+	}
+
+	// Inline PEM material takes precedence over the corresponding file
+	sslCert, sslKey, sslCA := n.SSLCert, n.SSLKey, n.SSLCA
+	if n.TLSCertPEM != "" {
+		sslCert, sslKey = "", ""
+	}
+	if n.TLSCAPEM != "" {
+		sslCA = ""
+	}
+
+	tlsCfg, err := internal.GetTLSConfig(
+		sslCert, sslKey, sslCA, n.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsCfg == nil && (n.tlsMinVersion != 0 || n.TLSServerName != "" ||
+		n.InsecureSkipTimeVerify || n.InsecureSkipHostnameVerify ||
+		n.hasInlineTLS() || n.serverCertFingerprint != nil || n.cipherSuites != nil ||
+		n.TLSPKCS12File != "" ||
+		len(n.TLSCAFiles) > 0 || n.TLSCADir != "") {
+		tlsCfg = &tls.Config{}
+	}
+	if tlsCfg == nil {
+		return nil, nil
+	}
+
+	if n.TLSCAPEM != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(n.TLSCAPEM)) {
+			return nil, errors.New("could not parse tls_ca_pem: no certificate found")
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if len(n.TLSCAFiles) > 0 || n.TLSCADir != "" {
+		if tlsCfg.RootCAs == nil {
+			tlsCfg.RootCAs = x509.NewCertPool()
+		}
+		if err := n.appendCAs(tlsCfg.RootCAs); err != nil {
+			return nil, err
+		}
+	}
+	if n.TLSCertPEM != "" {
+		cert, err := tls.X509KeyPair([]byte(n.TLSCertPEM), []byte(n.TLSKeyPEM))
+		if err != nil {
+			return nil, fmt.Errorf("could not load tls_cert_pem/tls_key_pem: %s", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if n.TLSPKCS12File != "" {
+		cert, err := loadPKCS12(n.TLSPKCS12File, n.TLSPKCS12Password)
+		if err != nil {
+			return nil, fmt.Errorf("could not load tls_pkcs12_file %s: %s",
+				n.TLSPKCS12File, err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(tlsCfg.Certificates) > 0 && sslCert != "" {
+		interval := n.TLSReloadInterval.Duration
+		if interval == 0 {
+			interval = time.Minute
+		}
+		reloader := &certReloader{
+			certFile: sslCert,
+			keyFile:  sslKey,
+			interval: interval,
+			cert:     &tlsCfg.Certificates[0],
+			loaded:   time.Now(),
+		}
+		tlsCfg.Certificates = nil
+		tlsCfg.NameToCertificate = nil
+		tlsCfg.GetClientCertificate = reloader.GetClientCertificate
+	}
+
+	if n.tlsMinVersion != 0 {
+		tlsCfg.MinVersion = n.tlsMinVersion
+	}
+	if n.TLSServerName != "" {
+		tlsCfg.ServerName = n.TLSServerName
+	}
+	if n.cipherSuites != nil {
+		tlsCfg.CipherSuites = n.cipherSuites
+	}
+	if n.verifiesChain() {
+		// The standard verification is replaced by verifyChain ignoring
+		// the dates or the host name
+		tlsCfg.InsecureSkipVerify = true
+	}
+	if n.serverCertFingerprint != nil || n.verifiesChain() {
+		tlsCfg.VerifyPeerCertificate = n.verifyPeerCertificate(
+			tlsCfg.RootCAs, tlsCfg.ServerName)
+	}
+
+	return tlsCfg, nil
+}
+
+// verifiesChain reports whether the server certificate is verified by
+// verifyChain instead of the standard verification.
+func (n *Nginx) verifiesChain() bool {
+	return (n.InsecureSkipTimeVerify || n.InsecureSkipHostnameVerify) &&
+		!n.InsecureSkipVerify
+}
+
+// verifyPeerCertificate returns the VerifyPeerCertificate callback for the
+// connections to serverName.
+func (n *Nginx) verifyPeerCertificate(
+	roots *x509.CertPool,
+	serverName string,
+) func([][]byte, [][]*x509.Certificate) error {
+	var checks []func([][]byte, [][]*x509.Certificate) error
+	if n.serverCertFingerprint != nil {
+		checks = append(checks, verifyFingerprint(n.serverCertFingerprint))
+	}
+	if n.verifiesChain() {
+		checks = append(checks, verifyChain(roots, serverName,
+			n.InsecureSkipTimeVerify, n.InsecureSkipHostnameVerify))
+	}
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		for _, check := range checks {
+			if err := check(rawCerts, verifiedChains); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// dialTLS returns the DialTLS function of the transport when verifyChain
+// checks the host name: the callback of the shared configuration does not
+// know which host a connection is for, so every connection gets its own.
+// The transport still uses the shared configuration for the connections
+// through a proxy.
+func (n *Nginx) dialTLS(
+	dial func(context.Context, string, string) (net.Conn, error),
+	cfg *tls.Config,
+) func(string, string) (net.Conn, error) {
+	return func(network, address string) (net.Conn, error) {
+		conn, err := dial(n.ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		connCfg := cfg.Clone()
+		if connCfg.ServerName == "" {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				host = address
+			}
+			connCfg.ServerName = host
+		}
+		connCfg.VerifyPeerCertificate = n.verifyPeerCertificate(
+			connCfg.RootCAs, connCfg.ServerName)
+
+		// The handshake is bounded by dial_timeout as well
+		if n.DialTimeout.Duration > 0 {
+			conn.SetDeadline(time.Now().Add(n.DialTimeout.Duration))
+		}
+		tlsConn := tls.Client(conn, connCfg)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, &handshakeError{err}
+		}
+		conn.SetDeadline(time.Time{})
+		return tlsConn, nil
+	}
+}
+
+// appendCAs adds the certificates of tls_ca_files and tls_ca_dir to pool.
+// Files in tls_ca_dir without a PEM certificate are skipped.
+func (n *Nginx) appendCAs(pool *x509.CertPool) error {
+	for _, file := range n.TLSCAFiles {
+		pem, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("could not read CA file: %s", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("could not parse CA file %s: no certificate found", file)
+		}
+	}
+
+	if n.TLSCADir == "" {
+		return nil
+	}
+	entries, err := ioutil.ReadDir(n.TLSCADir)
+	if err != nil {
+		return fmt.Errorf("could not read tls_ca_dir: %s", err)
+	}
+	var found bool
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+		pem, err := ioutil.ReadFile(filepath.Join(n.TLSCADir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("could not read CA file: %s", err)
+		}
+		if pool.AppendCertsFromPEM(pem) {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("no CA certificate found in %s", n.TLSCADir)
+	}
+	return nil
+}
+
+// loadPKCS12 reads the client certificate, its chain and the private key
+// from a PKCS#12 bundle.
+func loadPKCS12(file, password string) (tls.Certificate, error) {
+	var cert tls.Certificate
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return cert, err
+	}
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		return cert, err
+	}
+
+	var certs [][]byte
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			certs = append(certs, block.Bytes)
+		case "PRIVATE KEY":
+			// Converted to PKCS#1 or SEC 1 by ToPEM despite the type
+			if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+				cert.PrivateKey = key
+			} else if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+				cert.PrivateKey = key
+			} else {
+				return cert, errors.New("unsupported private key")
+			}
+		}
+	}
+	if cert.PrivateKey == nil {
+		return cert, errors.New("no private key found")
+	}
+
+	// The leaf, matching the private key, has to come first
+	public, err := x509.MarshalPKIXPublicKey(cert.PrivateKey.(crypto.Signer).Public())
+	if err != nil {
+		return cert, err
+	}
+	for i, der := range certs {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return cert, err
+		}
+		if certPublic, err := x509.MarshalPKIXPublicKey(c.PublicKey); err == nil &&
+			bytes.Equal(certPublic, public) {
+			cert.Leaf = c
+			cert.Certificate = append([][]byte{der}, certs[:i]...)
+			cert.Certificate = append(cert.Certificate, certs[i+1:]...)
+			return cert, nil
+		}
+	}
+	return cert, errors.New("no certificate matching the private key found")
+}
+
+// parseFingerprint decodes a hex SHA-256 fingerprint, colons are ignored.
+func parseFingerprint(s string) ([]byte, error) {
+	fingerprint, err := hex.DecodeString(strings.Replace(s, ":", "", -1))
+	if err != nil {
+		return nil, err
+	}
+	if len(fingerprint) != sha256.Size {
+		return nil, fmt.Errorf("expected %d bytes, got %d",
+			sha256.Size, len(fingerprint))
+	}
+	return fingerprint, nil
+}
+
+// verifyFingerprint returns a VerifyPeerCertificate callback rejecting any
+// leaf certificate whose SHA-256 does not match.  It also runs when
+// insecure_skip_verify disables the chain validation.
+func verifyFingerprint(expected []byte) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server did not present a certificate")
+		}
+		observed := sha256.Sum256(rawCerts[0])
+		if !bytes.Equal(observed[:], expected) {
+			return fmt.Errorf(
+				"server certificate fingerprint mismatch: observed %x, expected %x",
+				observed, expected)
+		}
+		return nil
+	}
+}
+
+// verifyChain returns a VerifyPeerCertificate callback checking the chain
+// and host name of the server certificate like the default verification.
+// With ignoreTime the chain is checked as of the start of the certificate's
+// validity so that an expired or not yet valid certificate is accepted, with
+// ignoreHostname any host name is accepted.
+func verifyChain(
+	roots *x509.CertPool,
+	serverName string,
+	ignoreTime, ignoreHostname bool,
+) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server did not present a certificate")
+		}
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("could not parse server certificate: %s", err)
+			}
+			certs = append(certs, cert)
+		}
+		leaf := certs[0]
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+		}
+		if ignoreTime {
+			opts.CurrentTime = leaf.NotBefore
+		}
+		if !ignoreHostname {
+			// A connection through a proxy does not tell the host
+			if serverName == "" {
+				return errors.New("unknown host name to verify the server " +
+					"certificate for, set tls_server_name")
+			}
+			opts.DNSName = serverName
+		}
+		_, err := leaf.Verify(opts)
+		return err
+	}
+}
+
+// certReloader serves the client certificate from ssl_cert/ssl_key and
+// re-reads the files once the cached copy is older than interval, so that
+// rotated certificates are used without restarting.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	sync.Mutex
+	cert   *tls.Certificate
+	loaded time.Time
+}
+
+func (r *certReloader) GetClientCertificate(
+	*tls.CertificateRequestInfo,
+) (*tls.Certificate, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.cert != nil && time.Since(r.loaded) < r.interval {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert == nil {
+			return nil, fmt.Errorf(
+				"could not load TLS client key/certificate from %s:%s: %s",
+				r.keyFile, r.certFile, err)
+		}
+		// Keep the previous certificate, the files may be halfway
+		// through being replaced.
+		log.Printf("W! nginx: could not reload TLS client certificate from %s: %s",
+			r.certFile, err)
+		r.loaded = time.Now()
+		return r.cert, nil
+	}
+
+	r.cert = &cert
+	r.loaded = time.Now()
+	return r.cert, nil
+}
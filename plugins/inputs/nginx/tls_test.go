@@ -0,0 +1,591 @@
+package nginx
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNginxTLSMinVersion(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	ts.TLS = &tls.Config{MaxVersion: tls.VersionTLS11}
+	ts.StartTLS()
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:               []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		InsecureSkipVerify: true,
+		TLSMinVersion:      "1.2",
+	}
+	var acc testutil.Accumulator
+	require.Error(t, acc.GatherError(n.Gather))
+	assert.False(t, acc.HasMeasurement("nginx"))
+}
+
+func TestNginxInitInvalidTLSMinVersion(t *testing.T) {
+	n := &Nginx{Urls: []string{"http://localhost/status"}, TLSMinVersion: "1.3"}
+	assert.Error(t, n.Init())
+
+	n = &Nginx{Urls: []string{"http://localhost/status"}, TLSMinVersion: "1.2"}
+	require.NoError(t, n.Init())
+	tlsCfg := n.client.Transport.(*http.Transport).TLSClientConfig
+	require.NotNil(t, tlsCfg)
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsCfg.MinVersion)
+}
+
+// writeCAFile stores the certificate of a TLS test server as a PEM file
+func writeCAFile(t *testing.T, ts *httptest.Server) string {
+	f, err := ioutil.TempFile("", "nginx_ca")
+	require.NoError(t, err)
+	defer f.Close()
+	err = pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	require.NoError(t, err)
+	return f.Name()
+}
+
+func TestNginxTLSServerName(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	caFile := writeCAFile(t, ts)
+	defer os.Remove(caFile)
+
+	// The test certificate is valid for example.com but not for the
+	// server name below.
+	n := &Nginx{
+		Urls:          []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		SSLCA:         caFile,
+		TLSServerName: "nginx.example.org",
+	}
+	var acc testutil.Accumulator
+	require.Error(t, acc.GatherError(n.Gather))
+
+	n = &Nginx{
+		Urls:          []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		SSLCA:         caFile,
+		TLSServerName: "example.com",
+	}
+	var accVerified testutil.Accumulator
+	require.NoError(t, accVerified.GatherError(n.Gather))
+	assert.True(t, accVerified.HasMeasurement("nginx"))
+}
+
+func TestNginxTLSInlineCA(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	n := &Nginx{
+		Urls:     []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		SSLCA:    "/nonexistent/ca.pem",
+		TLSCAPEM: string(caPEM),
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx"))
+}
+
+func TestNginxInitInvalidInlineTLS(t *testing.T) {
+	n := &Nginx{Urls: []string{"http://localhost/status"}, TLSCertPEM: "cert"}
+	assert.Error(t, n.Init())
+
+	n = &Nginx{Urls: []string{"http://localhost/status"}, TLSKeyPEM: "key"}
+	assert.Error(t, n.Init())
+
+	n = &Nginx{Urls: []string{"http://localhost/status"}, TLSCertPEM: "cert", TLSKeyPEM: "key"}
+	assert.Error(t, n.Init())
+
+	n = &Nginx{Urls: []string{"http://localhost/status"}, TLSCAPEM: "not a certificate"}
+	assert.Error(t, n.Init())
+}
+
+// writeClientCert generates a self-signed client certificate with the given
+// serial number and writes it along with its key to dir.
+func writeClientCert(t *testing.T, dir string, serial int64) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "telegraf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	err = ioutil.WriteFile(certFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	require.NoError(t, err)
+	return certFile, keyFile
+}
+
+func TestNginxTLSReloadClientCert(t *testing.T) {
+	var serial int64
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serial = r.TLS.PeerCertificates[0].SerialNumber.Int64()
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.Config.SetKeepAlivesEnabled(false)
+	ts.StartTLS()
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "nginx_tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeClientCert(t, dir, 1)
+	n := &Nginx{
+		Urls:               []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		SSLCert:            certFile,
+		SSLKey:             keyFile,
+		InsecureSkipVerify: true,
+		TLSReloadInterval:  internal.Duration{Duration: time.Nanosecond},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Equal(t, int64(1), serial)
+
+	writeClientCert(t, dir, 2)
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Equal(t, int64(2), serial)
+
+	// A broken rotation keeps using the last good certificate
+	require.NoError(t, ioutil.WriteFile(certFile, []byte("garbage"), 0600))
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.Equal(t, int64(2), serial)
+}
+
+func TestNginxTLSServerCertFingerprint(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	sum := sha256.Sum256(ts.Certificate().Raw)
+	n := &Nginx{
+		Urls:                     []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		InsecureSkipVerify:       true,
+		TLSServerCertFingerprint: strings.ToUpper(fmt.Sprintf("%x", sum)),
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx"))
+
+	sum[0]++
+	n = &Nginx{
+		Urls:                     []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		InsecureSkipVerify:       true,
+		TLSServerCertFingerprint: fmt.Sprintf("%x", sum),
+	}
+	var accMismatch testutil.Accumulator
+	err := accMismatch.GatherError(n.Gather)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "fingerprint mismatch")
+	assert.False(t, accMismatch.HasMeasurement("nginx"))
+}
+
+func TestNginxParseFingerprint(t *testing.T) {
+	fingerprint, err := parseFingerprint(
+		"AB:CD:EF:01:23:45:67:89:ab:cd:ef:01:23:45:67:89:" +
+			"ab:cd:ef:01:23:45:67:89:ab:cd:ef:01:23:45:67:89")
+	require.NoError(t, err)
+	assert.Len(t, fingerprint, sha256.Size)
+
+	_, err = parseFingerprint("abcd")
+	assert.Error(t, err)
+
+	n := &Nginx{Urls: []string{"http://localhost/status"}, TLSServerCertFingerprint: "not hex"}
+	assert.Error(t, n.Init())
+}
+
+func TestNginxTLSCAFilesAndDir(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "nginx_ca")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// An unrelated CA, as during a rotation before the server moved
+	otherCA, _ := writeClientCert(t, dir, 1)
+	serverCA := writeCAFile(t, ts)
+	defer os.Remove(serverCA)
+
+	n := &Nginx{
+		Urls:       []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		SSLCA:      otherCA,
+		TLSCAFiles: []string{serverCA},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx"))
+
+	n = &Nginx{
+		Urls:       []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		TLSCAFiles: []string{otherCA},
+	}
+	var accUntrusted testutil.Accumulator
+	require.Error(t, accUntrusted.GatherError(n.Gather))
+
+	caDir := filepath.Join(dir, "ca.d")
+	require.NoError(t, os.Mkdir(caDir, 0700))
+	content, err := ioutil.ReadFile(serverCA)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(caDir, "server.pem"), content, 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(caDir, "README"), []byte("CAs\n"), 0600))
+
+	n = &Nginx{
+		Urls:     []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		TLSCADir: caDir,
+	}
+	var accDir testutil.Accumulator
+	require.NoError(t, accDir.GatherError(n.Gather))
+	assert.True(t, accDir.HasMeasurement("nginx"))
+}
+
+func TestNginxInitInvalidTLSCAFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nginx_ca")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	notPEM := filepath.Join(dir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600))
+
+	tests := []*Nginx{
+		{TLSCAFiles: []string{filepath.Join(dir, "missing.pem")}},
+		{TLSCAFiles: []string{notPEM}},
+		{TLSCADir: filepath.Join(dir, "missing")},
+		{TLSCADir: dir},
+	}
+	for _, n := range tests {
+		n.Urls = []string{"http://localhost/status"}
+		assert.Error(t, n.Init())
+	}
+}
+
+func TestNginxTLSCipherSuites(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	ts.TLS = &tls.Config{
+		MaxVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384},
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:               []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		InsecureSkipVerify: true,
+		TLSCipherSuites:    []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx"))
+
+	n = &Nginx{
+		Urls:               []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		InsecureSkipVerify: true,
+		TLSCipherSuites:    []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+	}
+	var accMismatch testutil.Accumulator
+	require.Error(t, accMismatch.GatherError(n.Gather))
+
+	n = &Nginx{
+		Urls:            []string{"http://localhost/status"},
+		TLSCipherSuites: []string{"TLS_RSA_WITH_NULL"},
+	}
+	assert.Error(t, n.Init())
+}
+
+func TestNginxTLSPKCS12(t *testing.T) {
+	caPEM, err := ioutil.ReadFile("testdata/ca.crt")
+	require.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	require.True(t, clientCAs.AppendCertsFromPEM(caPEM))
+
+	var chain int
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chain = len(r.TLS.PeerCertificates)
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	// Only verifies with the intermediate sent by the client
+	ts.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:               []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		InsecureSkipVerify: true,
+		TLSPKCS12File:      "testdata/client.p12",
+		TLSPKCS12Password:  "telegraf",
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx"))
+	assert.Equal(t, 2, chain)
+
+	n = &Nginx{
+		Urls:              []string{"http://localhost/status"},
+		TLSPKCS12File:     "testdata/client.p12",
+		TLSPKCS12Password: "wrong",
+	}
+	assert.Error(t, n.Init())
+
+	n = &Nginx{
+		Urls:              []string{"http://localhost/status"},
+		TLSPKCS12File:     "testdata/client.p12",
+		TLSPKCS12Password: "telegraf",
+		SSLCert:           "/etc/telegraf/cert.pem",
+		SSLKey:            "/etc/telegraf/key.pem",
+	}
+	assert.Error(t, n.Init())
+}
+
+// expiredServerCert returns a CA in PEM and a server certificate for
+// 127.0.0.1 signed by it that expired an hour ago.
+func expiredServerCert(t *testing.T) (string, tls.Certificate) {
+	return serverCert(t, time.Now().Add(-time.Hour))
+}
+
+// serverCert returns the PEM of a new CA and a certificate for 127.0.0.1
+// signed by it, valid until notAfter.
+func serverCert(t *testing.T, notAfter time.Time) (string, tls.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Telegraf Test CA"},
+		NotBefore:             time.Now().Add(-48 * time.Hour),
+		NotAfter:              time.Now().Add(48 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDer)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDer})
+	return string(caPEM), tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestNginxTLSSkipTimeVerify(t *testing.T) {
+	caPEM, cert := expiredServerCert(t)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	n := &Nginx{
+		Urls:     []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		TLSCAPEM: caPEM,
+	}
+	var acc testutil.Accumulator
+	err := acc.GatherError(n.Gather)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expired")
+
+	n = &Nginx{
+		Urls:                   []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		TLSCAPEM:               caPEM,
+		InsecureSkipTimeVerify: true,
+	}
+	var accSkip testutil.Accumulator
+	require.NoError(t, accSkip.GatherError(n.Gather))
+	assert.True(t, accSkip.HasMeasurement("nginx"))
+
+	// The chain and host name are still verified
+	otherCA, _ := expiredServerCert(t)
+	n = &Nginx{
+		Urls:                   []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		TLSCAPEM:               otherCA,
+		InsecureSkipTimeVerify: true,
+	}
+	var accUntrusted testutil.Accumulator
+	err = accUntrusted.GatherError(n.Gather)
+	require.Error(t, err)
+	assert.Equal(t, PhaseTLS, errorPhase(err))
+
+	n = &Nginx{
+		Urls:                   []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		TLSCAPEM:               caPEM,
+		TLSServerName:          "nginx.example.com",
+		InsecureSkipTimeVerify: true,
+	}
+	var accHost testutil.Accumulator
+	require.Error(t, accHost.GatherError(n.Gather))
+
+	// The certificate is checked against the host of the URL
+	n = &Nginx{
+		Urls:                   []string{strings.Replace(ts.URL, "127.0.0.1", "localhost", 1) + "/stub_status"},
+		TLSCAPEM:               caPEM,
+		InsecureSkipTimeVerify: true,
+	}
+	var accURLHost testutil.Accumulator
+	require.Error(t, accURLHost.GatherError(n.Gather))
+}
+
+// connectProxy returns a proxy tunneling the CONNECT requests it receives.
+func connectProxy(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		go func() {
+			io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+		go func() {
+			io.Copy(conn, upstream)
+			conn.Close()
+		}()
+	}))
+}
+
+func TestNginxTLSSkipHostnameVerify(t *testing.T) {
+	caPEM, cert := serverCert(t, time.Now().Add(time.Hour))
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, nginxSampleResponse)
+	}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	// The certificate is issued for 127.0.0.1
+	n := &Nginx{
+		Urls:          []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		TLSCAPEM:      caPEM,
+		TLSServerName: "nginx.example.com",
+	}
+	var acc testutil.Accumulator
+	require.Error(t, acc.GatherError(n.Gather))
+
+	n = &Nginx{
+		Urls:                       []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		TLSCAPEM:                   caPEM,
+		TLSServerName:              "nginx.example.com",
+		InsecureSkipHostnameVerify: true,
+	}
+	var accSkip testutil.Accumulator
+	require.NoError(t, accSkip.GatherError(n.Gather))
+	assert.True(t, accSkip.HasMeasurement("nginx"))
+
+	// No host name is needed through a proxy either
+	proxy := connectProxy(t)
+	defer proxy.Close()
+	n = &Nginx{
+		Urls:                       []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		TLSCAPEM:                   caPEM,
+		HTTPProxyURL:               proxy.URL,
+		InsecureSkipHostnameVerify: true,
+	}
+	var accProxy testutil.Accumulator
+	require.NoError(t, accProxy.GatherError(n.Gather))
+	assert.True(t, accProxy.HasMeasurement("nginx"))
+
+	n = &Nginx{
+		Urls:                   []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		TLSCAPEM:               caPEM,
+		HTTPProxyURL:           proxy.URL,
+		InsecureSkipTimeVerify: true,
+	}
+	var accProxyHost testutil.Accumulator
+	err := accProxyHost.GatherError(n.Gather)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tls_server_name")
+
+	// The chain and dates are still verified
+	otherCA, _ := serverCert(t, time.Now().Add(time.Hour))
+	n = &Nginx{
+		Urls:                       []string{fmt.Sprintf("%s/stub_status", ts.URL)},
+		TLSCAPEM:                   otherCA,
+		InsecureSkipHostnameVerify: true,
+	}
+	var accUntrusted testutil.Accumulator
+	require.Error(t, accUntrusted.GatherError(n.Gather))
+
+	expiredCA, expired := expiredServerCert(t)
+	tsExpired := httptest.NewUnstartedServer(ts.Config.Handler)
+	tsExpired.TLS = &tls.Config{Certificates: []tls.Certificate{expired}}
+	tsExpired.StartTLS()
+	defer tsExpired.Close()
+	n = &Nginx{
+		Urls:                       []string{fmt.Sprintf("%s/stub_status", tsExpired.URL)},
+		TLSCAPEM:                   expiredCA,
+		InsecureSkipHostnameVerify: true,
+	}
+	var accExpired testutil.Accumulator
+	err = accExpired.GatherError(n.Gather)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expired")
+}
@@ -23,6 +23,10 @@ type NginxPlus struct {
 	client *http.Client
 
 	ResponseTimeout internal.Duration
+
+	// Gather from the versioned Nginx Plus API instead of the status module
+	PlusAPI    bool `toml:"plus_api"`
+	APIVersion int  `toml:"api_version"`
 }
 
 var sampleConfig = `
@@ -31,6 +35,13 @@ var sampleConfig = `
 
   # HTTP response timeout (default: 5s)
   response_timeout = "5s"
+
+  ## Gather from the Nginx Plus API (ngx_http_api_module) instead of the
+  ## status module.  When enabled, urls should point to the API root, for
+  ## example "http://localhost/api".
+  # plus_api = false
+  ## API version to request (default: 3)
+  # api_version = 3
 `
 
 func (n *NginxPlus) SampleConfig() string {
@@ -64,6 +75,10 @@ func (n *NginxPlus) Gather(acc telegraf.Accumulator) error {
 		wg.Add(1)
 		go func(addr *url.URL) {
 			defer wg.Done()
+			if n.PlusAPI {
+				n.gatherApiUrl(addr, acc)
+				return
+			}
 			acc.AddError(n.gatherUrl(addr, acc))
 		}(addr)
 	}
@@ -96,12 +111,32 @@ func (n *NginxPlus) gatherUrl(addr *url.URL, acc telegraf.Accumulator) error {
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("%s returned HTTP status %s", addr.String(), resp.Status)
 	}
+	// Some builds serve the status as text/plain, so the body is checked
+	// for a JSON object before relying on the content type.
+	r := bufio.NewReader(resp.Body)
 	contentType := strings.Split(resp.Header.Get("Content-Type"), ";")[0]
-	switch contentType {
-	case "application/json":
-		return gatherStatusUrl(bufio.NewReader(resp.Body), getTags(addr), acc)
-	default:
-		return fmt.Errorf("%s returned unexpected content type %s", addr.String(), contentType)
+	if contentType == "application/json" || isJSONObject(r) {
+		return gatherStatusUrl(r, getTags(addr), acc)
+	}
+	return fmt.Errorf("%s returned unexpected content type %s", addr.String(), contentType)
+}
+
+// isJSONObject reports whether the first non-whitespace byte of r opens a
+// JSON object, without consuming any input.
+func isJSONObject(r *bufio.Reader) bool {
+	for n := 1; ; n++ {
+		b, err := r.Peek(n)
+		if err != nil {
+			return false
+		}
+		switch b[n-1] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '{':
+			return true
+		default:
+			return false
+		}
 	}
 }
 
@@ -148,6 +183,218 @@ type HealthCheckStats struct {
 	LastPassed *bool `json:"last_passed"`
 }
 
+// NginxInfo is the nginx resource of the API, the load_timestamp is given
+// as an RFC 3339 date instead of milliseconds as in the status module.
+type NginxInfo struct {
+	Version       string `json:"version"`
+	Build         string `json:"build"`
+	Address       string `json:"address"`
+	Generation    *int   `json:"generation"`
+	LoadTimestamp string `json:"load_timestamp"`
+}
+
+type Processes struct {
+	Respawned *int `json:"respawned"`
+}
+
+type Connections struct {
+	Accepted int64 `json:"accepted"`
+	Dropped  int64 `json:"dropped"`
+	Active   int64 `json:"active"`
+	Idle     int64 `json:"idle"`
+}
+
+type Ssl struct {
+	Handshakes       int64 `json:"handshakes"`
+	HandshakesFailed int64 `json:"handshakes_failed"`
+	SessionReuses    int64 `json:"session_reuses"`
+}
+
+type Requests struct {
+	Total   int64 `json:"total"`
+	Current int   `json:"current"`
+}
+
+type ServerZone struct {
+	Processing int           `json:"processing"`
+	Requests   int64         `json:"requests"`
+	Responses  ResponseStats `json:"responses"`
+	Discarded  *int64        `json:"discarded"` // added in version 6
+	Received   int64         `json:"received"`
+	Sent       int64         `json:"sent"`
+}
+
+type LocationZone struct {
+	Requests  int64         `json:"requests"`
+	Responses ResponseStats `json:"responses"`
+	Discarded int64         `json:"discarded"`
+	Received  int64         `json:"received"`
+	Sent      int64         `json:"sent"`
+}
+
+type UpstreamPeer struct {
+	ID           *int             `json:"id"` // added in version 3
+	Server       string           `json:"server"`
+	Backup       bool             `json:"backup"`
+	Weight       int              `json:"weight"`
+	State        string           `json:"state"`
+	Active       int              `json:"active"`
+	Keepalive    *int             `json:"keepalive"` // removed in version 5
+	MaxConns     *int             `json:"max_conns"` // added in version 3
+	Requests     int64            `json:"requests"`
+	Responses    ResponseStats    `json:"responses"`
+	Sent         int64            `json:"sent"`
+	Received     int64            `json:"received"`
+	Fails        int64            `json:"fails"`
+	Unavail      int64            `json:"unavail"`
+	HealthChecks HealthCheckStats `json:"health_checks"`
+	Downtime     int64            `json:"downtime"`
+	Downstart    int64            `json:"downstart"`
+	Selected     *int64           `json:"selected"`      // added in version 4
+	HeaderTime   *int64           `json:"header_time"`   // added in version 5
+	ResponseTime *int64           `json:"response_time"` // added in version 5
+}
+
+type Upstream struct {
+	Peers     []UpstreamPeer `json:"peers"`
+	Keepalive int            `json:"keepalive"`
+	Zombies   *int           `json:"zombies"` // added in version 6
+	Queue     *struct {      // added in version 6
+		Size      int   `json:"size"`
+		MaxSize   int   `json:"max_size"`
+		Overflows int64 `json:"overflows"`
+	} `json:"queue"`
+}
+
+type Cache struct { // added in version 2
+	Size        int64            `json:"size"`
+	MaxSize     int64            `json:"max_size"`
+	Cold        coldFlag         `json:"cold"`
+	Hit         BasicHitStats    `json:"hit"`
+	Stale       BasicHitStats    `json:"stale"`
+	Updating    BasicHitStats    `json:"updating"`
+	Revalidated *BasicHitStats   `json:"revalidated"` // added in version 3
+	Miss        ExtendedHitStats `json:"miss"`
+	Expired     ExtendedHitStats `json:"expired"`
+	Bypass      ExtendedHitStats `json:"bypass"`
+}
+
+// coldFlag is true while a cache is still being loaded from disk after a
+// restart.  It is a boolean in the status and API of current versions, some
+// versions report it as 0 or 1.
+type coldFlag bool
+
+func (c *coldFlag) UnmarshalJSON(data []byte) error {
+	var cold bool
+	if err := json.Unmarshal(data, &cold); err == nil {
+		*c = coldFlag(cold)
+		return nil
+	}
+	var number float64
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("invalid cache cold state %s", data)
+	}
+	*c = number != 0
+	return nil
+}
+
+type LimitReq struct {
+	Passed         int64 `json:"passed"`
+	Delayed        int64 `json:"delayed"`
+	Rejected       int64 `json:"rejected"`
+	DelayedDryRun  int64 `json:"delayed_dry_run"`
+	RejectedDryRun int64 `json:"rejected_dry_run"`
+}
+
+type LimitConn struct {
+	Passed         int64 `json:"passed"`
+	Rejected       int64 `json:"rejected"`
+	RejectedDryRun int64 `json:"rejected_dry_run"`
+}
+
+type StreamServerZone struct {
+	Processing  int            `json:"processing"`
+	Connections int            `json:"connections"`
+	Sessions    *ResponseStats `json:"sessions"`
+	Discarded   *int64         `json:"discarded"` // added in version 7
+	Received    int64          `json:"received"`
+	Sent        int64          `json:"sent"`
+}
+
+type StreamUpstreamPeer struct {
+	ID            int              `json:"id"`
+	Server        string           `json:"server"`
+	Backup        bool             `json:"backup"`
+	Weight        int              `json:"weight"`
+	State         string           `json:"state"`
+	Active        int              `json:"active"`
+	Connections   int64            `json:"connections"`
+	ConnectTime   *int             `json:"connect_time"`
+	FirstByteTime *int             `json:"first_byte_time"`
+	ResponseTime  *int             `json:"response_time"`
+	Sent          int64            `json:"sent"`
+	Received      int64            `json:"received"`
+	Fails         int64            `json:"fails"`
+	Unavail       int64            `json:"unavail"`
+	HealthChecks  HealthCheckStats `json:"health_checks"`
+	Downtime      int64            `json:"downtime"`
+	Downstart     int64            `json:"downstart"`
+	Selected      int64            `json:"selected"`
+}
+
+type StreamUpstream struct {
+	Peers   []StreamUpstreamPeer `json:"peers"`
+	Zombies int                  `json:"zombies"`
+}
+
+type ZoneSync struct {
+	Status struct {
+		BytesIn     int64 `json:"bytes_in"`
+		MsgsIn      int64 `json:"msgs_in"`
+		MsgsOut     int64 `json:"msgs_out"`
+		BytesOut    int64 `json:"bytes_out"`
+		NodesOnline int64 `json:"nodes_online"`
+	} `json:"status"`
+	Zones map[string]ZoneSyncZone `json:"zones"`
+}
+
+type ZoneSyncZone struct {
+	RecordsPending int64 `json:"records_pending"`
+	RecordsTotal   int64 `json:"records_total"`
+}
+
+type Resolver struct {
+	Requests struct {
+		Name int64 `json:"name"`
+		Srv  int64 `json:"srv"`
+		Addr int64 `json:"addr"`
+	} `json:"requests"`
+	Responses struct {
+		Noerror  int64 `json:"noerror"`
+		Formerr  int64 `json:"formerr"`
+		Servfail int64 `json:"servfail"`
+		Nxdomain int64 `json:"nxdomain"`
+		Notimp   int64 `json:"notimp"`
+		Refused  int64 `json:"refused"`
+		Timedout int64 `json:"timedout"`
+		Unknown  int64 `json:"unknown"`
+	} `json:"responses"`
+}
+
+type Slab struct {
+	Pages struct {
+		Used int64 `json:"used"`
+		Free int64 `json:"free"`
+	} `json:"pages"`
+	// Slots are keyed by their size in bytes, e.g. "8", "16", ..., "2048"
+	Slots map[string]struct {
+		Used  int64 `json:"used"`
+		Free  int64 `json:"free"`
+		Reqs  int64 `json:"reqs"`
+		Fails int64 `json:"fails"`
+	} `json:"slots"`
+}
+
 type Status struct {
 	Version       int    `json:"version"`
 	NginxVersion  string `json:"nginx_version"`
@@ -157,189 +404,210 @@ type Status struct {
 	Timestamp     int64  `json:"timestamp"`
 	Pid           *int   `json:"pid"` // added in version 6
 
-	Processes *struct { // added in version 5
-		Respawned *int `json:"respawned"`
-	} `json:"processes"`
+	Processes *Processes `json:"processes"` // added in version 5
 
-	Connections struct {
-		Accepted int64 `json:"accepted"`
-		Dropped  int64 `json:"dropped"`
-		Active   int64 `json:"active"`
-		Idle     int64 `json:"idle"`
-	} `json:"connections"`
+	Connections *Connections `json:"connections"`
 
-	Ssl *struct { // added in version 6
-		Handshakes       int64 `json:"handshakes"`
-		HandshakesFailed int64 `json:"handshakes_failed"`
-		SessionReuses    int64 `json:"session_reuses"`
-	} `json:"ssl"`
+	Ssl *Ssl `json:"ssl"` // added in version 6
 
-	Requests struct {
-		Total   int64 `json:"total"`
-		Current int   `json:"current"`
-	} `json:"requests"`
+	Requests Requests `json:"requests"`
 
-	ServerZones map[string]struct { // added in version 2
-		Processing int           `json:"processing"`
-		Requests   int64         `json:"requests"`
-		Responses  ResponseStats `json:"responses"`
-		Discarded  *int64        `json:"discarded"` // added in version 6
-		Received   int64         `json:"received"`
-		Sent       int64         `json:"sent"`
-	} `json:"server_zones"`
-
-	Upstreams map[string]struct {
-		Peers []struct {
-			ID           *int             `json:"id"` // added in version 3
-			Server       string           `json:"server"`
-			Backup       bool             `json:"backup"`
-			Weight       int              `json:"weight"`
-			State        string           `json:"state"`
-			Active       int              `json:"active"`
-			Keepalive    *int             `json:"keepalive"` // removed in version 5
-			MaxConns     *int             `json:"max_conns"` // added in version 3
-			Requests     int64            `json:"requests"`
-			Responses    ResponseStats    `json:"responses"`
-			Sent         int64            `json:"sent"`
-			Received     int64            `json:"received"`
-			Fails        int64            `json:"fails"`
-			Unavail      int64            `json:"unavail"`
-			HealthChecks HealthCheckStats `json:"health_checks"`
-			Downtime     int64            `json:"downtime"`
-			Downstart    int64            `json:"downstart"`
-			Selected     *int64           `json:"selected"`      // added in version 4
-			HeaderTime   *int64           `json:"header_time"`   // added in version 5
-			ResponseTime *int64           `json:"response_time"` // added in version 5
-		} `json:"peers"`
-		Keepalive int       `json:"keepalive"`
-		Zombies   int       `json:"zombies"` // added in version 6
-		Queue     *struct { // added in version 6
-			Size      int   `json:"size"`
-			MaxSize   int   `json:"max_size"`
-			Overflows int64 `json:"overflows"`
-		} `json:"queue"`
-	} `json:"upstreams"`
-
-	Caches map[string]struct { // added in version 2
-		Size        int64            `json:"size"`
-		MaxSize     int64            `json:"max_size"`
-		Cold        bool             `json:"cold"`
-		Hit         BasicHitStats    `json:"hit"`
-		Stale       BasicHitStats    `json:"stale"`
-		Updating    BasicHitStats    `json:"updating"`
-		Revalidated *BasicHitStats   `json:"revalidated"` // added in version 3
-		Miss        ExtendedHitStats `json:"miss"`
-		Expired     ExtendedHitStats `json:"expired"`
-		Bypass      ExtendedHitStats `json:"bypass"`
-	} `json:"caches"`
+	ServerZones map[string]ServerZone `json:"server_zones"` // added in version 2
+
+	LocationZones map[string]LocationZone `json:"location_zones"`
+
+	Upstreams map[string]Upstream `json:"upstreams"`
+
+	Caches map[string]Cache `json:"caches"` // added in version 2
+
+	Resolvers map[string]Resolver `json:"resolvers"`
+
+	Slabs map[string]Slab `json:"slabs"`
 
 	Stream struct {
-		ServerZones map[string]struct {
-			Processing  int            `json:"processing"`
-			Connections int            `json:"connections"`
-			Sessions    *ResponseStats `json:"sessions"`
-			Discarded   *int64         `json:"discarded"` // added in version 7
-			Received    int64          `json:"received"`
-			Sent        int64          `json:"sent"`
-		} `json:"server_zones"`
-		Upstreams map[string]struct {
-			Peers []struct {
-				ID            int              `json:"id"`
-				Server        string           `json:"server"`
-				Backup        bool             `json:"backup"`
-				Weight        int              `json:"weight"`
-				State         string           `json:"state"`
-				Active        int              `json:"active"`
-				Connections   int64            `json:"connections"`
-				ConnectTime   *int             `json:"connect_time"`
-				FirstByteTime *int             `json:"first_byte_time"`
-				ResponseTime  *int             `json:"response_time"`
-				Sent          int64            `json:"sent"`
-				Received      int64            `json:"received"`
-				Fails         int64            `json:"fails"`
-				Unavail       int64            `json:"unavail"`
-				HealthChecks  HealthCheckStats `json:"health_checks"`
-				Downtime      int64            `json:"downtime"`
-				Downstart     int64            `json:"downstart"`
-				Selected      int64            `json:"selected"`
-			} `json:"peers"`
-			Zombies int `json:"zombies"`
-		} `json:"upstreams"`
+		ServerZones map[string]StreamServerZone `json:"server_zones"`
+		Upstreams   map[string]StreamUpstream   `json:"upstreams"`
+		ZoneSync    *ZoneSync                   `json:"zone_sync"` // only in clusters
 	} `json:"stream"`
 }
 
 func gatherStatusUrl(r *bufio.Reader, tags map[string]string, acc telegraf.Accumulator) error {
 	dec := json.NewDecoder(r)
 	status := &Status{}
-	if err := dec.Decode(status); err != nil {
-		return fmt.Errorf("Error while decoding JSON response")
+	parseErrors, err := decodeStatus(dec, status, tags, acc)
+	if err != nil {
+		return fmt.Errorf("Error while decoding JSON response: %s", err)
 	}
 	status.Gather(tags, acc)
+	acc.AddFields("nginx_plus_scrape",
+		map[string]interface{}{"parse_errors": parseErrors},
+		tags)
 	return nil
 }
 
+// decodeStatus decodes the status document one top-level member at a time.
+// The HTTP and stream upstreams, which make up most of the document on
+// large clusters, are gathered as soon as each upstream is decoded and are
+// not kept in status, so memory does not grow with the number of peers.
+//
+// Values of an unexpected type, as seen when the status version differs
+// from the one this plugin knows, are counted in parseErrors and the rest
+// of the document is still gathered.  Only malformed JSON is an error.
+func decodeStatus(
+	dec *json.Decoder,
+	status *Status,
+	tags map[string]string,
+	acc telegraf.Accumulator,
+) (int, error) {
+	var parseErrors int
+	recoverable := func(err error) error {
+		if _, ok := err.(*json.UnmarshalTypeError); ok {
+			parseErrors++
+			return nil
+		}
+		return err
+	}
+
+	err := decodeObject(dec, func(key string) error {
+		switch key {
+		case "upstreams":
+			return decodeObject(dec, func(name string) error {
+				var upstream Upstream
+				if err := recoverable(dec.Decode(&upstream)); err != nil {
+					return err
+				}
+				s := &Status{Upstreams: map[string]Upstream{name: upstream}}
+				s.gatherUpstreamMetrics(tags, acc)
+				return nil
+			})
+		case "stream":
+			return decodeObject(dec, func(key string) error {
+				switch key {
+				case "upstreams":
+					return decodeObject(dec, func(name string) error {
+						var upstream StreamUpstream
+						if err := recoverable(dec.Decode(&upstream)); err != nil {
+							return err
+						}
+						s := &Status{}
+						s.Stream.Upstreams = map[string]StreamUpstream{name: upstream}
+						s.gatherStreamMetrics(tags, acc)
+						return nil
+					})
+				case "server_zones":
+					return recoverable(dec.Decode(&status.Stream.ServerZones))
+				case "zone_sync":
+					return recoverable(dec.Decode(&status.Stream.ZoneSync))
+				default:
+					return skipValue(dec)
+				}
+			})
+		default:
+			return recoverable(decodeMember(dec, key, status))
+		}
+	})
+	return parseErrors, err
+}
+
+// decodeObject calls fn with the key of every member of the JSON object at
+// the current position of dec, fn has to consume the value.  A null value is
+// treated as an empty object.
+func decodeObject(dec *json.Decoder, fn func(key string) error) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return nil
+	}
+	if delim, ok := t.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expected object, got %v", t)
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if err := fn(t.(string)); err != nil {
+			return err
+		}
+	}
+	// closing brace
+	_, err = dec.Token()
+	return err
+}
+
+// decodeMember decodes the next value into the field of v tagged as key.
+func decodeMember(dec *json.Decoder, key string, v interface{}) error {
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	name, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	member := make([]byte, 0, len(name)+len(raw)+3)
+	member = append(member, '{')
+	member = append(member, name...)
+	member = append(member, ':')
+	member = append(member, raw...)
+	member = append(member, '}')
+	return json.Unmarshal(member, v)
+}
+
+func skipValue(dec *json.Decoder) error {
+	var raw json.RawMessage
+	return dec.Decode(&raw)
+}
+
 func (s *Status) Gather(tags map[string]string, acc telegraf.Accumulator) {
+	s.gatherInfoMetrics(tags, acc)
 	s.gatherProcessesMetrics(tags, acc)
 	s.gatherConnectionsMetrics(tags, acc)
 	s.gatherSslMetrics(tags, acc)
 	s.gatherRequestMetrics(tags, acc)
 	s.gatherZoneMetrics(tags, acc)
+	s.gatherLocationZoneMetrics(tags, acc)
 	s.gatherUpstreamMetrics(tags, acc)
 	s.gatherCacheMetrics(tags, acc)
+	s.gatherResolverMetrics(tags, acc)
+	s.gatherSlabMetrics(tags, acc)
 	s.gatherStreamMetrics(tags, acc)
+	s.gatherZoneSyncMetrics(tags, acc)
 }
 
-func (s *Status) gatherProcessesMetrics(tags map[string]string, acc telegraf.Accumulator) {
-	var respawned int
-
-	if s.Processes.Respawned != nil {
-		respawned = *s.Processes.Respawned
+func (s *Status) gatherInfoMetrics(tags map[string]string, acc telegraf.Accumulator) {
+	if s.Generation == nil && s.LoadTimestamp == nil {
+		return
 	}
+	addInfo(acc, "nginx_plus_info", s.NginxVersion, "", s.Address,
+		s.Generation, s.LoadTimestamp, tags)
+}
 
-	acc.AddFields(
-		"nginx_plus_processes",
-		map[string]interface{}{
-			"respawned": respawned,
-		},
-		tags,
-	)
-
+func (s *Status) gatherProcessesMetrics(tags map[string]string, acc telegraf.Accumulator) {
+	if s.Processes == nil {
+		return
+	}
+	acc.AddCounter("nginx_plus_processes", processesFields(s.Processes), tags)
 }
 
 func (s *Status) gatherConnectionsMetrics(tags map[string]string, acc telegraf.Accumulator) {
-	acc.AddFields(
-		"nginx_plus_connections",
-		map[string]interface{}{
-			"accepted": s.Connections.Accepted,
-			"dropped":  s.Connections.Dropped,
-			"active":   s.Connections.Active,
-			"idle":     s.Connections.Idle,
-		},
-		tags,
-	)
+	if s.Connections == nil {
+		return
+	}
+	addConnections(acc, "nginx_plus_connections", s.Connections, tags)
 }
 
 func (s *Status) gatherSslMetrics(tags map[string]string, acc telegraf.Accumulator) {
-	acc.AddFields(
-		"nginx_plus_ssl",
-		map[string]interface{}{
-			"handshakes":        s.Ssl.Handshakes,
-			"handshakes_failed": s.Ssl.HandshakesFailed,
-			"session_reuses":    s.Ssl.SessionReuses,
-		},
-		tags,
-	)
+	if s.Ssl == nil {
+		return
+	}
+	acc.AddCounter("nginx_plus_ssl", sslFields(s.Ssl), tags)
 }
 
 func (s *Status) gatherRequestMetrics(tags map[string]string, acc telegraf.Accumulator) {
-	acc.AddFields(
-		"nginx_plus_requests",
-		map[string]interface{}{
-			"total":   s.Requests.Total,
-			"current": s.Requests.Current,
-		},
-		tags,
-	)
+	addRequests(acc, "nginx_plus_requests", &s.Requests, tags)
 }
 
 func (s *Status) gatherZoneMetrics(tags map[string]string, acc telegraf.Accumulator) {
@@ -349,28 +617,18 @@ func (s *Status) gatherZoneMetrics(tags map[string]string, acc telegraf.Accumula
 			zoneTags[k] = v
 		}
 		zoneTags["zone"] = zoneName
-		acc.AddFields(
-			"nginx_plus_zone",
-			func() map[string]interface{} {
-				result := map[string]interface{}{
-					"processing":      zone.Processing,
-					"requests":        zone.Requests,
-					"responses_1xx":   zone.Responses.Responses1xx,
-					"responses_2xx":   zone.Responses.Responses2xx,
-					"responses_3xx":   zone.Responses.Responses3xx,
-					"responses_4xx":   zone.Responses.Responses4xx,
-					"responses_5xx":   zone.Responses.Responses5xx,
-					"responses_total": zone.Responses.Total,
-					"received":        zone.Received,
-					"sent":            zone.Sent,
-				}
-				if zone.Discarded != nil {
-					result["discarded"] = *zone.Discarded
-				}
-				return result
-			}(),
-			zoneTags,
-		)
+		acc.AddFields("nginx_plus_zone", serverZoneFields(&zone), zoneTags)
+	}
+}
+
+func (s *Status) gatherLocationZoneMetrics(tags map[string]string, acc telegraf.Accumulator) {
+	for zoneName, zone := range s.LocationZones {
+		zoneTags := map[string]string{}
+		for k, v := range tags {
+			zoneTags[k] = v
+		}
+		zoneTags["zone"] = zoneName
+		acc.AddFields("nginx_plus_location_zone", locationZoneFields(&zone), zoneTags)
 	}
 }
 
@@ -381,71 +639,13 @@ func (s *Status) gatherUpstreamMetrics(tags map[string]string, acc telegraf.Accu
 			upstreamTags[k] = v
 		}
 		upstreamTags["upstream"] = upstreamName
-		upstreamFields := map[string]interface{}{
-			"keepalive": upstream.Keepalive,
-			"zombies":   upstream.Zombies,
-		}
-		if upstream.Queue != nil {
-			upstreamFields["queue_size"] = upstream.Queue.Size
-			upstreamFields["queue_max_size"] = upstream.Queue.MaxSize
-			upstreamFields["queue_overflows"] = upstream.Queue.Overflows
-		}
-		acc.AddFields(
-			"nginx_plus_upstream",
-			upstreamFields,
-			upstreamTags,
-		)
+		acc.AddFields("nginx_plus_upstream", upstreamFields(&upstream), upstreamTags)
 		for _, peer := range upstream.Peers {
-			var selected int64
-
-			if peer.Selected != nil {
-				selected = *peer.Selected
-			}
-
-			peerFields := map[string]interface{}{
-				"backup":                 peer.Backup,
-				"weight":                 peer.Weight,
-				"state":                  peer.State,
-				"active":                 peer.Active,
-				"requests":               peer.Requests,
-				"responses_1xx":          peer.Responses.Responses1xx,
-				"responses_2xx":          peer.Responses.Responses2xx,
-				"responses_3xx":          peer.Responses.Responses3xx,
-				"responses_4xx":          peer.Responses.Responses4xx,
-				"responses_5xx":          peer.Responses.Responses5xx,
-				"responses_total":        peer.Responses.Total,
-				"sent":                   peer.Sent,
-				"received":               peer.Received,
-				"fails":                  peer.Fails,
-				"unavail":                peer.Unavail,
-				"healthchecks_checks":    peer.HealthChecks.Checks,
-				"healthchecks_fails":     peer.HealthChecks.Fails,
-				"healthchecks_unhealthy": peer.HealthChecks.Unhealthy,
-				"downtime":               peer.Downtime,
-				"downstart":              peer.Downstart,
-				"selected":               selected,
-			}
-			if peer.HealthChecks.LastPassed != nil {
-				peerFields["healthchecks_last_passed"] = *peer.HealthChecks.LastPassed
-			}
-			if peer.HeaderTime != nil {
-				peerFields["header_time"] = *peer.HeaderTime
-			}
-			if peer.ResponseTime != nil {
-				peerFields["response_time"] = *peer.ResponseTime
-			}
-			if peer.MaxConns != nil {
-				peerFields["max_conns"] = *peer.MaxConns
-			}
-			peerTags := map[string]string{}
-			for k, v := range upstreamTags {
-				peerTags[k] = v
-			}
-			peerTags["upstream_address"] = peer.Server
-			if peer.ID != nil {
-				peerTags["id"] = strconv.Itoa(*peer.ID)
-			}
-			acc.AddFields("nginx_plus_upstream_peer", peerFields, peerTags)
+			acc.AddFields(
+				"nginx_plus_upstream_peer",
+				upstreamPeerFields(&peer),
+				upstreamPeerTags(&peer, upstreamTags),
+			)
 		}
 	}
 }
@@ -456,36 +656,30 @@ func (s *Status) gatherCacheMetrics(tags map[string]string, acc telegraf.Accumul
 		for k, v := range tags {
 			cacheTags[k] = v
 		}
-		cacheTags["cache"] = cacheName
-		acc.AddFields(
-			"nginx_plus_cache",
-			map[string]interface{}{
-				"size":                      cache.Size,
-				"max_size":                  cache.MaxSize,
-				"cold":                      cache.Cold,
-				"hit_responses":             cache.Hit.Responses,
-				"hit_bytes":                 cache.Hit.Bytes,
-				"stale_responses":           cache.Stale.Responses,
-				"stale_bytes":               cache.Stale.Bytes,
-				"updating_responses":        cache.Updating.Responses,
-				"updating_bytes":            cache.Updating.Bytes,
-				"revalidated_responses":     cache.Revalidated.Responses,
-				"revalidated_bytes":         cache.Revalidated.Bytes,
-				"miss_responses":            cache.Miss.Responses,
-				"miss_bytes":                cache.Miss.Bytes,
-				"miss_responses_written":    cache.Miss.ResponsesWritten,
-				"miss_bytes_written":        cache.Miss.BytesWritten,
-				"expired_responses":         cache.Expired.Responses,
-				"expired_bytes":             cache.Expired.Bytes,
-				"expired_responses_written": cache.Expired.ResponsesWritten,
-				"expired_bytes_written":     cache.Expired.BytesWritten,
-				"bypass_responses":          cache.Bypass.Responses,
-				"bypass_bytes":              cache.Bypass.Bytes,
-				"bypass_responses_written":  cache.Bypass.ResponsesWritten,
-				"bypass_bytes_written":      cache.Bypass.BytesWritten,
-			},
-			cacheTags,
-		)
+		cacheTags["zone"] = cacheName
+		acc.AddFields("nginx_plus_cache", cacheFields(&cache), cacheTags)
+	}
+}
+
+func (s *Status) gatherResolverMetrics(tags map[string]string, acc telegraf.Accumulator) {
+	for zoneName, resolver := range s.Resolvers {
+		resolverTags := map[string]string{}
+		for k, v := range tags {
+			resolverTags[k] = v
+		}
+		resolverTags["zone"] = zoneName
+		acc.AddFields("nginx_plus_resolver", resolverFields(&resolver), resolverTags)
+	}
+}
+
+func (s *Status) gatherSlabMetrics(tags map[string]string, acc telegraf.Accumulator) {
+	for zoneName, slab := range s.Slabs {
+		slabTags := map[string]string{}
+		for k, v := range tags {
+			slabTags[k] = v
+		}
+		slabTags["zone"] = zoneName
+		acc.AddFields("nginx_plus_slab", slabFields(&slab), slabTags)
 	}
 }
 
@@ -496,16 +690,7 @@ func (s *Status) gatherStreamMetrics(tags map[string]string, acc telegraf.Accumu
 			zoneTags[k] = v
 		}
 		zoneTags["zone"] = zoneName
-		acc.AddFields(
-			"nginx.stream.zone",
-			map[string]interface{}{
-				"processing":  zone.Processing,
-				"connections": zone.Connections,
-				"received":    zone.Received,
-				"sent":        zone.Sent,
-			},
-			zoneTags,
-		)
+		acc.AddFields("nginx_plus_stream_server_zone", streamServerZoneFields(&zone), zoneTags)
 	}
 	for upstreamName, upstream := range s.Stream.Upstreams {
 		upstreamTags := map[string]string{}
@@ -513,52 +698,419 @@ func (s *Status) gatherStreamMetrics(tags map[string]string, acc telegraf.Accumu
 			upstreamTags[k] = v
 		}
 		upstreamTags["upstream"] = upstreamName
-		acc.AddFields(
-			"nginx_plus_stream_upstream",
-			map[string]interface{}{
-				"zombies": upstream.Zombies,
-			},
-			upstreamTags,
-		)
+		acc.AddFields("nginx_plus_stream_upstream", streamUpstreamFields(&upstream), upstreamTags)
 		for _, peer := range upstream.Peers {
-			peerFields := map[string]interface{}{
-				"backup":                 peer.Backup,
-				"weight":                 peer.Weight,
-				"state":                  peer.State,
-				"active":                 peer.Active,
-				"connections":            peer.Connections,
-				"sent":                   peer.Sent,
-				"received":               peer.Received,
-				"fails":                  peer.Fails,
-				"unavail":                peer.Unavail,
-				"healthchecks_checks":    peer.HealthChecks.Checks,
-				"healthchecks_fails":     peer.HealthChecks.Fails,
-				"healthchecks_unhealthy": peer.HealthChecks.Unhealthy,
-				"downtime":               peer.Downtime,
-				"downstart":              peer.Downstart,
-				"selected":               peer.Selected,
-			}
-			if peer.HealthChecks.LastPassed != nil {
-				peerFields["healthchecks_last_passed"] = *peer.HealthChecks.LastPassed
-			}
-			if peer.ConnectTime != nil {
-				peerFields["connect_time"] = *peer.ConnectTime
-			}
-			if peer.FirstByteTime != nil {
-				peerFields["first_byte_time"] = *peer.FirstByteTime
-			}
-			if peer.ResponseTime != nil {
-				peerFields["response_time"] = *peer.ResponseTime
-			}
-			peerTags := map[string]string{}
-			for k, v := range upstreamTags {
-				peerTags[k] = v
-			}
-			peerTags["upstream_address"] = peer.Server
-			peerTags["id"] = strconv.Itoa(peer.ID)
-			acc.AddFields("nginx_plus_stream_upstream_peer", peerFields, peerTags)
+			acc.AddFields(
+				"nginx_plus_stream_upstream_peer",
+				streamUpstreamPeerFields(&peer),
+				streamUpstreamPeerTags(&peer, upstreamTags),
+			)
+		}
+	}
+}
+
+func (s *Status) gatherZoneSyncMetrics(tags map[string]string, acc telegraf.Accumulator) {
+	if s.Stream.ZoneSync == nil {
+		return
+	}
+	addZoneSync(acc, "nginx_plus_zone_sync", s.Stream.ZoneSync, tags)
+}
+
+// Numeric representation of the upstream peer states, 0 is used for states
+// unknown to this plugin.
+var peerStateCodes = map[string]int{
+	"up":        1,
+	"draining":  2,
+	"down":      3,
+	"unavail":   4,
+	"checking":  5,
+	"unhealthy": 6,
+}
+
+// The field builders below are shared between the status module and the
+// versioned API, which report the same objects at different locations.
+
+// addInfo adds the configuration generation as a counter and the time the
+// configuration was last loaded, in milliseconds since the epoch, as a gauge,
+// both at the same time.  They are tagged with the version, build and address
+// of the instance.
+func addInfo(
+	acc telegraf.Accumulator,
+	measurement string,
+	version, build, address string,
+	generation *int,
+	loadTimestamp *int64,
+	tags map[string]string,
+) {
+	infoTags := map[string]string{}
+	for k, v := range tags {
+		infoTags[k] = v
+	}
+	for k, v := range map[string]string{"version": version, "build": build, "address": address} {
+		if v != "" {
+			infoTags[k] = v
 		}
 	}
+
+	now := time.Now()
+	if generation != nil {
+		acc.AddCounter(measurement, map[string]interface{}{"generation": *generation}, infoTags, now)
+	}
+	if loadTimestamp != nil {
+		acc.AddGauge(measurement, map[string]interface{}{"load_timestamp": *loadTimestamp}, infoTags, now)
+	}
+}
+
+func processesFields(p *Processes) map[string]interface{} {
+	var respawned int
+
+	if p.Respawned != nil {
+		respawned = *p.Respawned
+	}
+
+	return map[string]interface{}{
+		"respawned": respawned,
+	}
+}
+
+// addConnections adds the accepted and dropped totals as a counter and the
+// current connection states as a gauge, both at the same time.
+func addConnections(
+	acc telegraf.Accumulator,
+	measurement string,
+	c *Connections,
+	tags map[string]string,
+) {
+	now := time.Now()
+	acc.AddCounter(measurement,
+		map[string]interface{}{
+			"accepted": c.Accepted,
+			"dropped":  c.Dropped,
+		},
+		tags, now)
+	acc.AddGauge(measurement,
+		map[string]interface{}{
+			"active": c.Active,
+			"idle":   c.Idle,
+		},
+		tags, now)
+}
+
+// addZoneSync adds the message and byte totals of the node as a counter and
+// the nodes online and the records of every zone as gauges, all at the same
+// time.
+func addZoneSync(
+	acc telegraf.Accumulator,
+	measurement string,
+	zs *ZoneSync,
+	tags map[string]string,
+) {
+	now := time.Now()
+	acc.AddCounter(measurement,
+		map[string]interface{}{
+			"bytes_in":  zs.Status.BytesIn,
+			"msgs_in":   zs.Status.MsgsIn,
+			"msgs_out":  zs.Status.MsgsOut,
+			"bytes_out": zs.Status.BytesOut,
+		},
+		tags, now)
+	acc.AddGauge(measurement,
+		map[string]interface{}{
+			"nodes_online": zs.Status.NodesOnline,
+		},
+		tags, now)
+	for zoneName, zone := range zs.Zones {
+		zoneTags := map[string]string{}
+		for k, v := range tags {
+			zoneTags[k] = v
+		}
+		zoneTags["zone"] = zoneName
+		acc.AddGauge(measurement,
+			map[string]interface{}{
+				"records_pending": zone.RecordsPending,
+				"records_total":   zone.RecordsTotal,
+			},
+			zoneTags, now)
+	}
+}
+
+func sslFields(ssl *Ssl) map[string]interface{} {
+	return map[string]interface{}{
+		"handshakes":        ssl.Handshakes,
+		"handshakes_failed": ssl.HandshakesFailed,
+		"session_reuses":    ssl.SessionReuses,
+	}
+}
+
+// addRequests adds the request total as a counter and the requests
+// currently processed as a gauge, both at the same time.
+func addRequests(
+	acc telegraf.Accumulator,
+	measurement string,
+	r *Requests,
+	tags map[string]string,
+) {
+	now := time.Now()
+	acc.AddCounter(measurement, map[string]interface{}{"total": r.Total}, tags, now)
+	acc.AddGauge(measurement, map[string]interface{}{"current": r.Current}, tags, now)
+}
+
+func serverZoneFields(zone *ServerZone) map[string]interface{} {
+	result := map[string]interface{}{
+		"processing":      zone.Processing,
+		"requests":        zone.Requests,
+		"responses_1xx":   zone.Responses.Responses1xx,
+		"responses_2xx":   zone.Responses.Responses2xx,
+		"responses_3xx":   zone.Responses.Responses3xx,
+		"responses_4xx":   zone.Responses.Responses4xx,
+		"responses_5xx":   zone.Responses.Responses5xx,
+		"responses_total": zone.Responses.Total,
+		"received":        zone.Received,
+		"sent":            zone.Sent,
+	}
+	if zone.Discarded != nil {
+		result["discarded"] = *zone.Discarded
+	}
+	return result
+}
+
+func locationZoneFields(zone *LocationZone) map[string]interface{} {
+	return map[string]interface{}{
+		"requests":        zone.Requests,
+		"responses_1xx":   zone.Responses.Responses1xx,
+		"responses_2xx":   zone.Responses.Responses2xx,
+		"responses_3xx":   zone.Responses.Responses3xx,
+		"responses_4xx":   zone.Responses.Responses4xx,
+		"responses_5xx":   zone.Responses.Responses5xx,
+		"responses_total": zone.Responses.Total,
+		"discarded":       zone.Discarded,
+		"received":        zone.Received,
+		"sent":            zone.Sent,
+	}
+}
+
+func upstreamFields(upstream *Upstream) map[string]interface{} {
+	fields := map[string]interface{}{
+		"keepalive": upstream.Keepalive,
+	}
+	if upstream.Zombies != nil {
+		fields["zombies"] = *upstream.Zombies
+	}
+	if upstream.Queue != nil {
+		fields["queue_size"] = upstream.Queue.Size
+		fields["queue_max_size"] = upstream.Queue.MaxSize
+		fields["queue_overflows"] = upstream.Queue.Overflows
+	}
+	return fields
+}
+
+func upstreamPeerFields(peer *UpstreamPeer) map[string]interface{} {
+	var selected int64
+
+	if peer.Selected != nil {
+		selected = *peer.Selected
+	}
+
+	fields := map[string]interface{}{
+		"backup":                 peer.Backup,
+		"weight":                 peer.Weight,
+		"state":                  peer.State,
+		"state_code":             peerStateCodes[peer.State],
+		"active":                 peer.Active,
+		"requests":               peer.Requests,
+		"responses_1xx":          peer.Responses.Responses1xx,
+		"responses_2xx":          peer.Responses.Responses2xx,
+		"responses_3xx":          peer.Responses.Responses3xx,
+		"responses_4xx":          peer.Responses.Responses4xx,
+		"responses_5xx":          peer.Responses.Responses5xx,
+		"responses_total":        peer.Responses.Total,
+		"sent":                   peer.Sent,
+		"received":               peer.Received,
+		"fails":                  peer.Fails,
+		"unavail":                peer.Unavail,
+		"healthchecks_checks":    peer.HealthChecks.Checks,
+		"healthchecks_fails":     peer.HealthChecks.Fails,
+		"healthchecks_unhealthy": peer.HealthChecks.Unhealthy,
+		"downtime":               peer.Downtime,
+		"downstart":              peer.Downstart,
+		"selected":               selected,
+	}
+	if peer.HealthChecks.LastPassed != nil {
+		fields["healthchecks_last_passed"] = *peer.HealthChecks.LastPassed
+	}
+	if peer.HeaderTime != nil {
+		fields["header_time"] = *peer.HeaderTime
+	}
+	if peer.ResponseTime != nil {
+		fields["response_time"] = *peer.ResponseTime
+	}
+	if peer.MaxConns != nil {
+		fields["max_conns"] = *peer.MaxConns
+	}
+	return fields
+}
+
+func upstreamPeerTags(peer *UpstreamPeer, upstreamTags map[string]string) map[string]string {
+	peerTags := map[string]string{}
+	for k, v := range upstreamTags {
+		peerTags[k] = v
+	}
+	peerTags["upstream_address"] = peer.Server
+	peerTags["backup"] = strconv.FormatBool(peer.Backup)
+	if peer.ID != nil {
+		peerTags["id"] = strconv.Itoa(*peer.ID)
+	}
+	return peerTags
+}
+
+func cacheFields(cache *Cache) map[string]interface{} {
+	fields := map[string]interface{}{
+		"size":                      cache.Size,
+		"max_size":                  cache.MaxSize,
+		"cold":                      bool(cache.Cold),
+		"hit_responses":             cache.Hit.Responses,
+		"hit_bytes":                 cache.Hit.Bytes,
+		"stale_responses":           cache.Stale.Responses,
+		"stale_bytes":               cache.Stale.Bytes,
+		"updating_responses":        cache.Updating.Responses,
+		"updating_bytes":            cache.Updating.Bytes,
+		"miss_responses":            cache.Miss.Responses,
+		"miss_bytes":                cache.Miss.Bytes,
+		"miss_responses_written":    cache.Miss.ResponsesWritten,
+		"miss_bytes_written":        cache.Miss.BytesWritten,
+		"expired_responses":         cache.Expired.Responses,
+		"expired_bytes":             cache.Expired.Bytes,
+		"expired_responses_written": cache.Expired.ResponsesWritten,
+		"expired_bytes_written":     cache.Expired.BytesWritten,
+		"bypass_responses":          cache.Bypass.Responses,
+		"bypass_bytes":              cache.Bypass.Bytes,
+		"bypass_responses_written":  cache.Bypass.ResponsesWritten,
+		"bypass_bytes_written":      cache.Bypass.BytesWritten,
+	}
+	if cache.Revalidated != nil {
+		fields["revalidated_responses"] = cache.Revalidated.Responses
+		fields["revalidated_bytes"] = cache.Revalidated.Bytes
+	}
+	return fields
+}
+
+func resolverFields(resolver *Resolver) map[string]interface{} {
+	return map[string]interface{}{
+		"requests_name":      resolver.Requests.Name,
+		"requests_srv":       resolver.Requests.Srv,
+		"requests_addr":      resolver.Requests.Addr,
+		"responses_noerror":  resolver.Responses.Noerror,
+		"responses_formerr":  resolver.Responses.Formerr,
+		"responses_servfail": resolver.Responses.Servfail,
+		"responses_nxdomain": resolver.Responses.Nxdomain,
+		"responses_notimp":   resolver.Responses.Notimp,
+		"responses_refused":  resolver.Responses.Refused,
+		"responses_timedout": resolver.Responses.Timedout,
+		"responses_unknown":  resolver.Responses.Unknown,
+	}
+}
+
+func slabFields(slab *Slab) map[string]interface{} {
+	var requests, fails int64
+	for _, slot := range slab.Slots {
+		requests += slot.Reqs
+		fails += slot.Fails
+	}
+
+	return map[string]interface{}{
+		"pages_used": slab.Pages.Used,
+		"pages_free": slab.Pages.Free,
+		"requests":   requests,
+		"fails":      fails,
+	}
+}
+
+func limitReqFields(limit *LimitReq) map[string]interface{} {
+	return map[string]interface{}{
+		"passed":           limit.Passed,
+		"delayed":          limit.Delayed,
+		"rejected":         limit.Rejected,
+		"delayed_dry_run":  limit.DelayedDryRun,
+		"rejected_dry_run": limit.RejectedDryRun,
+	}
+}
+
+func limitConnFields(limit *LimitConn) map[string]interface{} {
+	return map[string]interface{}{
+		"passed":           limit.Passed,
+		"rejected":         limit.Rejected,
+		"rejected_dry_run": limit.RejectedDryRun,
+	}
+}
+
+func streamServerZoneFields(zone *StreamServerZone) map[string]interface{} {
+	fields := map[string]interface{}{
+		"processing":  zone.Processing,
+		"connections": zone.Connections,
+		"received":    zone.Received,
+		"sent":        zone.Sent,
+	}
+	if zone.Sessions != nil {
+		fields["sessions_2xx"] = zone.Sessions.Responses2xx
+		fields["sessions_4xx"] = zone.Sessions.Responses4xx
+		fields["sessions_5xx"] = zone.Sessions.Responses5xx
+		fields["sessions_total"] = zone.Sessions.Total
+	}
+	if zone.Discarded != nil {
+		fields["discarded"] = *zone.Discarded
+	}
+	return fields
+}
+
+func streamUpstreamFields(upstream *StreamUpstream) map[string]interface{} {
+	return map[string]interface{}{
+		"zombies": upstream.Zombies,
+	}
+}
+
+func streamUpstreamPeerFields(peer *StreamUpstreamPeer) map[string]interface{} {
+	fields := map[string]interface{}{
+		"backup":                 peer.Backup,
+		"weight":                 peer.Weight,
+		"state":                  peer.State,
+		"state_code":             peerStateCodes[peer.State],
+		"active":                 peer.Active,
+		"connections":            peer.Connections,
+		"sent":                   peer.Sent,
+		"received":               peer.Received,
+		"fails":                  peer.Fails,
+		"unavail":                peer.Unavail,
+		"healthchecks_checks":    peer.HealthChecks.Checks,
+		"healthchecks_fails":     peer.HealthChecks.Fails,
+		"healthchecks_unhealthy": peer.HealthChecks.Unhealthy,
+		"downtime":               peer.Downtime,
+		"downstart":              peer.Downstart,
+		"selected":               peer.Selected,
+	}
+	if peer.HealthChecks.LastPassed != nil {
+		fields["healthchecks_last_passed"] = *peer.HealthChecks.LastPassed
+	}
+	if peer.ConnectTime != nil {
+		fields["connect_time"] = *peer.ConnectTime
+	}
+	if peer.FirstByteTime != nil {
+		fields["first_byte_time"] = *peer.FirstByteTime
+	}
+	if peer.ResponseTime != nil {
+		fields["response_time"] = *peer.ResponseTime
+	}
+	return fields
+}
+
+func streamUpstreamPeerTags(peer *StreamUpstreamPeer, upstreamTags map[string]string) map[string]string {
+	peerTags := map[string]string{}
+	for k, v := range upstreamTags {
+		peerTags[k] = v
+	}
+	peerTags["upstream_address"] = peer.Server
+	peerTags["backup"] = strconv.FormatBool(peer.Backup)
+	peerTags["id"] = strconv.Itoa(peer.ID)
+	return peerTags
 }
 
 func init() {
@@ -0,0 +1,300 @@
+package nginx_plus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+const defaultAPIVersion = 3
+
+// The Nginx Plus API answers 404 for resources whose module is not
+// configured, e.g. stream endpoints on a server without a stream block.
+var errApiResourceNotFound = errors.New("API resource not found")
+
+// Resource every version of the Nginx Plus API has, requested first
+const apiRootResource = "nginx"
+
+// Resources requested from the Nginx Plus API, relative to /api/{version}/
+var apiResources = []string{
+	apiRootResource,
+	"processes",
+	"connections",
+	"ssl",
+	"http/requests",
+	"http/server_zones",
+	"http/location_zones",
+	"http/upstreams",
+	"http/caches",
+	"http/limit_reqs",
+	"http/limit_conns",
+	"http/keyvals",
+	"resolvers",
+	"slabs",
+	"stream/server_zones",
+	"stream/upstreams",
+	"stream/zone_sync",
+	"stream/keyvals",
+}
+
+func (n *NginxPlus) gatherApiUrl(addr *url.URL, acc telegraf.Accumulator) {
+	for _, resource := range apiResources {
+		err := n.gatherApiResource(addr, resource, acc)
+		if err == errApiResourceNotFound && resource == apiRootResource {
+			// The other resources would not be found either
+			acc.AddError(fmt.Errorf("%s not found, check url and api_version",
+				n.apiResourceUrl(addr, resource)))
+			return
+		}
+		if err != nil && err != errApiResourceNotFound {
+			acc.AddError(err)
+		}
+	}
+}
+
+func (n *NginxPlus) gatherApiResource(addr *url.URL, resource string, acc telegraf.Accumulator) error {
+	tags := getTags(addr)
+	measurement := "nginx_plus_api_" + strings.Replace(resource, "/", "_", -1)
+
+	switch resource {
+	case apiRootResource:
+		info := &NginxInfo{}
+		if err := n.decodeApiResource(addr, resource, info); err != nil {
+			return err
+		}
+		var loadTimestamp *int64
+		if loaded, err := time.Parse(time.RFC3339, info.LoadTimestamp); err == nil {
+			ms := loaded.UnixNano() / int64(time.Millisecond)
+			loadTimestamp = &ms
+		}
+		addInfo(acc, measurement, info.Version, info.Build, info.Address,
+			info.Generation, loadTimestamp, tags)
+	case "processes":
+		processes := &Processes{}
+		if err := n.decodeApiResource(addr, resource, processes); err != nil {
+			return err
+		}
+		acc.AddCounter(measurement, processesFields(processes), tags)
+	case "connections":
+		connections := &Connections{}
+		if err := n.decodeApiResource(addr, resource, connections); err != nil {
+			return err
+		}
+		addConnections(acc, measurement, connections, tags)
+	case "ssl":
+		ssl := &Ssl{}
+		if err := n.decodeApiResource(addr, resource, ssl); err != nil {
+			return err
+		}
+		acc.AddCounter(measurement, sslFields(ssl), tags)
+	case "http/requests":
+		requests := &Requests{}
+		if err := n.decodeApiResource(addr, resource, requests); err != nil {
+			return err
+		}
+		addRequests(acc, measurement, requests, tags)
+	case "http/server_zones":
+		zones := map[string]ServerZone{}
+		if err := n.decodeApiResource(addr, resource, &zones); err != nil {
+			return err
+		}
+		for zoneName, zone := range zones {
+			zoneTags := map[string]string{}
+			for k, v := range tags {
+				zoneTags[k] = v
+			}
+			zoneTags["zone"] = zoneName
+			acc.AddFields(measurement, serverZoneFields(&zone), zoneTags)
+		}
+	case "http/location_zones":
+		zones := map[string]LocationZone{}
+		if err := n.decodeApiResource(addr, resource, &zones); err != nil {
+			return err
+		}
+		for zoneName, zone := range zones {
+			zoneTags := map[string]string{}
+			for k, v := range tags {
+				zoneTags[k] = v
+			}
+			zoneTags["zone"] = zoneName
+			acc.AddFields(measurement, locationZoneFields(&zone), zoneTags)
+		}
+	case "http/upstreams":
+		upstreams := map[string]Upstream{}
+		if err := n.decodeApiResource(addr, resource, &upstreams); err != nil {
+			return err
+		}
+		for upstreamName, upstream := range upstreams {
+			upstreamTags := map[string]string{}
+			for k, v := range tags {
+				upstreamTags[k] = v
+			}
+			upstreamTags["upstream"] = upstreamName
+			acc.AddFields(measurement, upstreamFields(&upstream), upstreamTags)
+			for _, peer := range upstream.Peers {
+				acc.AddFields(
+					"nginx_plus_api_http_upstream_peers",
+					upstreamPeerFields(&peer),
+					upstreamPeerTags(&peer, upstreamTags),
+				)
+			}
+		}
+	case "http/caches":
+		caches := map[string]Cache{}
+		if err := n.decodeApiResource(addr, resource, &caches); err != nil {
+			return err
+		}
+		for cacheName, cache := range caches {
+			cacheTags := map[string]string{}
+			for k, v := range tags {
+				cacheTags[k] = v
+			}
+			cacheTags["zone"] = cacheName
+			acc.AddFields(measurement, cacheFields(&cache), cacheTags)
+		}
+	case "http/limit_reqs":
+		limits := map[string]LimitReq{}
+		if err := n.decodeApiResource(addr, resource, &limits); err != nil {
+			return err
+		}
+		for zoneName, limit := range limits {
+			zoneTags := map[string]string{}
+			for k, v := range tags {
+				zoneTags[k] = v
+			}
+			zoneTags["zone"] = zoneName
+			acc.AddCounter("nginx_plus_limit_req", limitReqFields(&limit), zoneTags)
+		}
+	case "http/limit_conns":
+		limits := map[string]LimitConn{}
+		if err := n.decodeApiResource(addr, resource, &limits); err != nil {
+			return err
+		}
+		for zoneName, limit := range limits {
+			zoneTags := map[string]string{}
+			for k, v := range tags {
+				zoneTags[k] = v
+			}
+			zoneTags["zone"] = zoneName
+			acc.AddCounter("nginx_plus_limit_conn", limitConnFields(&limit), zoneTags)
+		}
+	case "http/keyvals", "stream/keyvals":
+		// Only the contents of the zones are exposed, the number of keys
+		// is what tells how full a zone is.
+		keyvals := map[string]map[string]string{}
+		if err := n.decodeApiResource(addr, resource, &keyvals); err != nil {
+			return err
+		}
+		for zoneName, keyval := range keyvals {
+			zoneTags := map[string]string{}
+			for k, v := range tags {
+				zoneTags[k] = v
+			}
+			zoneTags["zone"] = zoneName
+			acc.AddGauge(measurement, map[string]interface{}{"keys": len(keyval)}, zoneTags)
+		}
+	case "resolvers":
+		resolvers := map[string]Resolver{}
+		if err := n.decodeApiResource(addr, resource, &resolvers); err != nil {
+			return err
+		}
+		for zoneName, resolver := range resolvers {
+			resolverTags := map[string]string{}
+			for k, v := range tags {
+				resolverTags[k] = v
+			}
+			resolverTags["zone"] = zoneName
+			acc.AddFields(measurement, resolverFields(&resolver), resolverTags)
+		}
+	case "slabs":
+		slabs := map[string]Slab{}
+		if err := n.decodeApiResource(addr, resource, &slabs); err != nil {
+			return err
+		}
+		for zoneName, slab := range slabs {
+			slabTags := map[string]string{}
+			for k, v := range tags {
+				slabTags[k] = v
+			}
+			slabTags["zone"] = zoneName
+			acc.AddFields(measurement, slabFields(&slab), slabTags)
+		}
+	case "stream/server_zones":
+		zones := map[string]StreamServerZone{}
+		if err := n.decodeApiResource(addr, resource, &zones); err != nil {
+			return err
+		}
+		for zoneName, zone := range zones {
+			zoneTags := map[string]string{}
+			for k, v := range tags {
+				zoneTags[k] = v
+			}
+			zoneTags["zone"] = zoneName
+			acc.AddFields(measurement, streamServerZoneFields(&zone), zoneTags)
+		}
+	case "stream/upstreams":
+		upstreams := map[string]StreamUpstream{}
+		if err := n.decodeApiResource(addr, resource, &upstreams); err != nil {
+			return err
+		}
+		for upstreamName, upstream := range upstreams {
+			upstreamTags := map[string]string{}
+			for k, v := range tags {
+				upstreamTags[k] = v
+			}
+			upstreamTags["upstream"] = upstreamName
+			acc.AddFields(measurement, streamUpstreamFields(&upstream), upstreamTags)
+			for _, peer := range upstream.Peers {
+				acc.AddFields(
+					"nginx_plus_api_stream_upstream_peers",
+					streamUpstreamPeerFields(&peer),
+					streamUpstreamPeerTags(&peer, upstreamTags),
+				)
+			}
+		}
+	case "stream/zone_sync":
+		zoneSync := &ZoneSync{}
+		if err := n.decodeApiResource(addr, resource, zoneSync); err != nil {
+			return err
+		}
+		addZoneSync(acc, measurement, zoneSync, tags)
+	default:
+		return fmt.Errorf("unknown Nginx Plus API resource %s", resource)
+	}
+	return nil
+}
+
+func (n *NginxPlus) apiResourceUrl(addr *url.URL, resource string) string {
+	version := n.APIVersion
+	if version <= 0 {
+		version = defaultAPIVersion
+	}
+	return fmt.Sprintf("%s/%d/%s", strings.TrimSuffix(addr.String(), "/"), version, resource)
+}
+
+func (n *NginxPlus) decodeApiResource(addr *url.URL, resource string, v interface{}) error {
+	resourceUrl := n.apiResourceUrl(addr, resource)
+
+	resp, err := n.client.Get(resourceUrl)
+	if err != nil {
+		return fmt.Errorf("error making HTTP request to %s: %s", resourceUrl, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errApiResourceNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned HTTP status %s", resourceUrl, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("Error while decoding JSON response from %s", resourceUrl)
+	}
+	return nil
+}
@@ -0,0 +1,398 @@
+package nginx_plus
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sampleApiResponses = map[string]string{
+	"/api/3/nginx": `{
+		"version": "1.21.6",
+		"build": "nginx-plus-r27",
+		"address": "10.0.0.10",
+		"generation": 6,
+		"load_timestamp": "2022-06-28T11:15:44.467Z",
+		"timestamp": "2022-06-28T11:20:00.000Z",
+		"pid": 1234,
+		"ppid": 1
+	}`,
+	"/api/3/processes": `{"respawned": 2}`,
+	"/api/3/connections": `{
+		"accepted": 1234,
+		"dropped": 5,
+		"active": 6,
+		"idle": 7
+	}`,
+	"/api/3/ssl": `{
+		"handshakes": 100,
+		"handshakes_failed": 2,
+		"session_reuses": 30
+	}`,
+	"/api/3/http/requests": `{"total": 4321, "current": 9}`,
+	"/api/3/http/server_zones": `{
+		"site1": {
+			"processing": 1,
+			"requests": 500,
+			"responses": {
+				"1xx": 0,
+				"2xx": 450,
+				"3xx": 20,
+				"4xx": 25,
+				"5xx": 5,
+				"total": 500
+			},
+			"discarded": 3,
+			"received": 2048,
+			"sent": 4096
+		}
+	}`,
+	"/api/3/http/location_zones": `{
+		"checkout": {
+			"requests": 120,
+			"responses": {
+				"1xx": 0,
+				"2xx": 110,
+				"3xx": 0,
+				"4xx": 9,
+				"5xx": 1,
+				"total": 120
+			},
+			"discarded": 2,
+			"received": 512,
+			"sent": 1024
+		}
+	}`,
+	"/api/3/http/upstreams": `{
+		"backend": {
+			"peers": [
+				{
+					"id": 0,
+					"server": "10.0.0.1:80",
+					"backup": false,
+					"weight": 1,
+					"state": "up",
+					"active": 2,
+					"requests": 300,
+					"responses": {
+						"1xx": 0,
+						"2xx": 290,
+						"3xx": 0,
+						"4xx": 8,
+						"5xx": 2,
+						"total": 300
+					},
+					"sent": 1000,
+					"received": 2000,
+					"fails": 1,
+					"unavail": 0,
+					"health_checks": {
+						"checks": 10,
+						"fails": 0,
+						"unhealthy": 0
+					},
+					"downtime": 0,
+					"downstart": 0,
+					"selected": 1451606400000
+				}
+			],
+			"keepalive": 4,
+			"zombies": 0
+		}
+	}`,
+	"/api/3/http/caches": `{}`,
+	"/api/3/http/limit_reqs": `{
+		"login": {"passed": 100, "delayed": 5, "rejected": 12, "delayed_dry_run": 0, "rejected_dry_run": 0},
+		"idle": {"passed": 0, "delayed": 0, "rejected": 0, "delayed_dry_run": 0, "rejected_dry_run": 0}
+	}`,
+	"/api/3/http/keyvals": `{
+		"one": {"key1": "value1", "key2": "value2"},
+		"empty": {}
+	}`,
+	"/api/3/http/limit_conns": `{
+		"perip": {"passed": 80, "rejected": 3, "rejected_dry_run": 1}
+	}`,
+	"/api/3/resolvers": `{
+		"resolver_01": {
+			"requests": {"name": 10, "srv": 0, "addr": 1},
+			"responses": {"noerror": 9, "nxdomain": 1, "timedout": 1}
+		}
+	}`,
+}
+
+func TestNginxPlusApiGeneratesMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rsp, ok := sampleApiResponses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header()["Content-Type"] = []string{"application/json"}
+		fmt.Fprint(w, rsp)
+	}))
+	defer ts.Close()
+
+	n := &NginxPlus{
+		Urls:    []string{fmt.Sprintf("%s/api", ts.URL)},
+		PlusAPI: true,
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+
+	addr, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	tags := getTags(addr)
+
+	assertTypedFields(t, &acc, "nginx_plus_api_processes", telegraf.Counter,
+		map[string]interface{}{
+			"respawned": int(2),
+		},
+		tags)
+
+	assertTypedFields(t, &acc, "nginx_plus_api_connections", telegraf.Counter,
+		map[string]interface{}{
+			"accepted": int64(1234),
+			"dropped":  int64(5),
+		},
+		tags)
+	assertTypedFields(t, &acc, "nginx_plus_api_connections", telegraf.Gauge,
+		map[string]interface{}{
+			"active": int64(6),
+			"idle":   int64(7),
+		},
+		tags)
+	assertSharedTimestamp(t, &acc, "nginx_plus_api_connections")
+
+	assertTypedFields(t, &acc, "nginx_plus_api_http_requests", telegraf.Counter,
+		map[string]interface{}{
+			"total": int64(4321),
+		},
+		tags)
+	assertTypedFields(t, &acc, "nginx_plus_api_http_requests", telegraf.Gauge,
+		map[string]interface{}{
+			"current": int(9),
+		},
+		tags)
+	assertSharedTimestamp(t, &acc, "nginx_plus_api_http_requests")
+
+	zoneTags := map[string]string{"zone": "site1"}
+	for k, v := range tags {
+		zoneTags[k] = v
+	}
+	acc.AssertContainsTaggedFields(t, "nginx_plus_api_http_server_zones",
+		map[string]interface{}{
+			"processing":      int(1),
+			"requests":        int64(500),
+			"responses_1xx":   int64(0),
+			"responses_2xx":   int64(450),
+			"responses_3xx":   int64(20),
+			"responses_4xx":   int64(25),
+			"responses_5xx":   int64(5),
+			"responses_total": int64(500),
+			"discarded":       int64(3),
+			"received":        int64(2048),
+			"sent":            int64(4096),
+		},
+		zoneTags)
+
+	locationTags := map[string]string{"zone": "checkout"}
+	for k, v := range tags {
+		locationTags[k] = v
+	}
+	acc.AssertContainsTaggedFields(t, "nginx_plus_api_http_location_zones",
+		map[string]interface{}{
+			"requests":        int64(120),
+			"responses_1xx":   int64(0),
+			"responses_2xx":   int64(110),
+			"responses_3xx":   int64(0),
+			"responses_4xx":   int64(9),
+			"responses_5xx":   int64(1),
+			"responses_total": int64(120),
+			"discarded":       int64(2),
+			"received":        int64(512),
+			"sent":            int64(1024),
+		},
+		locationTags)
+
+	upstreamTags := map[string]string{"upstream": "backend"}
+	for k, v := range tags {
+		upstreamTags[k] = v
+	}
+	acc.AssertContainsTaggedFields(t, "nginx_plus_api_http_upstreams",
+		map[string]interface{}{
+			"keepalive": int(4),
+			"zombies":   int(0),
+		},
+		upstreamTags)
+
+	assert.True(t, acc.HasMeasurement("nginx_plus_api_http_upstream_peers"))
+	assert.Equal(t, "10.0.0.1:80", acc.TagValue("nginx_plus_api_http_upstream_peers", "upstream_address"))
+
+	resolverTags := map[string]string{"zone": "resolver_01"}
+	for k, v := range tags {
+		resolverTags[k] = v
+	}
+	acc.AssertContainsTaggedFields(t, "nginx_plus_api_resolvers",
+		map[string]interface{}{
+			"requests_name":      int64(10),
+			"requests_srv":       int64(0),
+			"requests_addr":      int64(1),
+			"responses_noerror":  int64(9),
+			"responses_formerr":  int64(0),
+			"responses_servfail": int64(0),
+			"responses_nxdomain": int64(1),
+			"responses_notimp":   int64(0),
+			"responses_refused":  int64(0),
+			"responses_timedout": int64(1),
+			"responses_unknown":  int64(0),
+		},
+		resolverTags)
+
+	loginTags := map[string]string{"zone": "login"}
+	idleTags := map[string]string{"zone": "idle"}
+	peripTags := map[string]string{"zone": "perip"}
+	for k, v := range tags {
+		loginTags[k] = v
+		idleTags[k] = v
+		peripTags[k] = v
+	}
+	assertTypedFields(t, &acc, "nginx_plus_limit_req", telegraf.Counter,
+		map[string]interface{}{
+			"passed":           int64(100),
+			"delayed":          int64(5),
+			"rejected":         int64(12),
+			"delayed_dry_run":  int64(0),
+			"rejected_dry_run": int64(0),
+		},
+		loginTags)
+	assertTypedFields(t, &acc, "nginx_plus_limit_req", telegraf.Counter,
+		map[string]interface{}{
+			"passed":           int64(0),
+			"delayed":          int64(0),
+			"rejected":         int64(0),
+			"delayed_dry_run":  int64(0),
+			"rejected_dry_run": int64(0),
+		},
+		idleTags)
+	assertTypedFields(t, &acc, "nginx_plus_limit_conn", telegraf.Counter,
+		map[string]interface{}{
+			"passed":           int64(80),
+			"rejected":         int64(3),
+			"rejected_dry_run": int64(1),
+		},
+		peripTags)
+
+	oneTags := map[string]string{"zone": "one"}
+	emptyTags := map[string]string{"zone": "empty"}
+	for k, v := range tags {
+		oneTags[k] = v
+		emptyTags[k] = v
+	}
+	assertTypedFields(t, &acc, "nginx_plus_api_http_keyvals", telegraf.Gauge,
+		map[string]interface{}{"keys": 2}, oneTags)
+	assertTypedFields(t, &acc, "nginx_plus_api_http_keyvals", telegraf.Gauge,
+		map[string]interface{}{"keys": 0}, emptyTags)
+
+	infoTags := map[string]string{
+		"version": "1.21.6",
+		"build":   "nginx-plus-r27",
+		"address": "10.0.0.10",
+	}
+	for k, v := range tags {
+		infoTags[k] = v
+	}
+	assertTypedFields(t, &acc, "nginx_plus_api_nginx", telegraf.Counter,
+		map[string]interface{}{"generation": 6}, infoTags)
+	assertTypedFields(t, &acc, "nginx_plus_api_nginx", telegraf.Gauge,
+		map[string]interface{}{"load_timestamp": int64(1656414944467)}, infoTags)
+	assertSharedTimestamp(t, &acc, "nginx_plus_api_nginx")
+
+	// Stream resources are not configured on the test server
+	acc.AssertDoesNotContainMeasurement(t, "nginx_plus_api_stream_server_zones")
+	acc.AssertDoesNotContainMeasurement(t, "nginx_plus_api_stream_upstreams")
+	acc.AssertDoesNotContainMeasurement(t, "nginx_plus_api_stream_zone_sync")
+	acc.AssertDoesNotContainMeasurement(t, "nginx_plus_api_stream_keyvals")
+	assert.Empty(t, acc.Errors)
+}
+
+func TestNginxPlusApiWrongVersion(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rsp, ok := sampleApiResponses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header()["Content-Type"] = []string{"application/json"}
+		fmt.Fprint(w, rsp)
+	}))
+	defer ts.Close()
+
+	n := &NginxPlus{
+		Urls:       []string{fmt.Sprintf("%s/api", ts.URL)},
+		PlusAPI:    true,
+		APIVersion: 9,
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, n.Gather(&acc))
+	require.Len(t, acc.Errors, 1)
+	assert.Contains(t, acc.Errors[0].Error(), "/api/9/nginx not found")
+	assert.Empty(t, acc.Metrics)
+}
+
+func TestNginxPlusApiZoneSync(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/3/nginx" {
+			fmt.Fprint(w, sampleApiResponses[r.URL.Path])
+			return
+		}
+		if r.URL.Path != "/api/3/stream/zone_sync" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header()["Content-Type"] = []string{"application/json"}
+		fmt.Fprint(w, `{
+			"status": {"bytes_in": 100, "msgs_in": 10, "msgs_out": 12, "bytes_out": 120, "nodes_online": 2},
+			"zones": {"sessions": {"records_pending": 1, "records_total": 30}}
+		}`)
+	}))
+	defer ts.Close()
+
+	n := &NginxPlus{
+		Urls:    []string{fmt.Sprintf("%s/api", ts.URL)},
+		PlusAPI: true,
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+
+	addr, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	tags := getTags(addr)
+
+	assertTypedFields(t, &acc, "nginx_plus_api_stream_zone_sync", telegraf.Gauge,
+		map[string]interface{}{
+			"nodes_online": int64(2),
+		},
+		tags)
+	zoneTags := map[string]string{"zone": "sessions"}
+	for k, v := range tags {
+		zoneTags[k] = v
+	}
+	assertTypedFields(t, &acc, "nginx_plus_api_stream_zone_sync", telegraf.Gauge,
+		map[string]interface{}{
+			"records_pending": int64(1),
+			"records_total":   int64(30),
+		},
+		zoneTags)
+	assertSharedTimestamp(t, &acc, "nginx_plus_api_stream_zone_sync")
+	assert.Empty(t, acc.Errors)
+}
@@ -1,15 +1,24 @@
 package nginx_plus
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/testutil"
-	//"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -179,11 +188,50 @@ const sampleStatusResponse = `
             }
         }
     },
+    "resolvers": {
+        "resolver_01": {
+            "requests": {
+                "name": 101,
+                "srv": 2,
+                "addr": 3
+            },
+            "responses": {
+                "noerror": 97,
+                "formerr": 0,
+                "servfail": 1,
+                "nxdomain": 6,
+                "notimp": 0,
+                "refused": 0,
+                "timedout": 2,
+                "unknown": 0
+            }
+        }
+    },
+    "slabs": {
+        "keyval_zone": {
+            "pages": {
+                "used": 3,
+                "free": 61
+            },
+            "slots": {
+                "8": {"used": 1, "free": 503, "reqs": 10, "fails": 0},
+                "64": {"used": 2, "free": 62, "reqs": 20, "fails": 1},
+                "512": {"used": 0, "free": 0, "reqs": 5, "fails": 2}
+            }
+        }
+    },
     "stream": {
         "server_zones": {
             "stream.zone.01": {
                 "processing": 24,
                 "connections": 46,
+                "sessions": {
+                    "2xx": 40,
+                    "4xx": 4,
+                    "5xx": 2,
+                    "total": 46
+                },
+                "discarded": 1,
                 "received": 68,
                 "sent": 80
             },
@@ -249,6 +297,54 @@ const sampleStatusResponse = `
 }
 `
 
+// assertTypedFields checks the fields of the measurement added with the
+// given value type.
+func assertTypedFields(
+	t *testing.T,
+	acc *testutil.Accumulator,
+	measurement string,
+	valueType telegraf.ValueType,
+	fields map[string]interface{},
+	tags map[string]string,
+) {
+	for _, m := range acc.Metrics {
+		if m.Measurement == measurement && m.Type == valueType &&
+			reflect.DeepEqual(tags, m.Tags) {
+			assert.Equal(t, fields, m.Fields)
+			return
+		}
+	}
+	assert.Fail(t, fmt.Sprintf("unknown measurement %s of type %d with tags %v",
+		measurement, valueType, tags))
+}
+
+// assertSharedTimestamp checks that the metrics of the measurement, split
+// by value type, were all added at the same time.
+func assertSharedTimestamp(t *testing.T, acc *testutil.Accumulator, measurement string) {
+	var times []time.Time
+	for _, m := range acc.Metrics {
+		if m.Measurement == measurement {
+			times = append(times, m.Time)
+		}
+	}
+	require.True(t, len(times) > 1, "expected several %s metrics", measurement)
+	for _, ts := range times[1:] {
+		assert.True(t, times[0].Equal(ts), "%s metrics at %s and %s", measurement, times[0], ts)
+	}
+}
+
+func TestNginxPlusUpstreamFields(t *testing.T) {
+	zombies := 3
+	assert.Equal(t,
+		map[string]interface{}{"keepalive": 4, "zombies": 3},
+		upstreamFields(&Upstream{Keepalive: 4, Zombies: &zombies}))
+
+	// Status versions before 6 have no zombies
+	assert.Equal(t,
+		map[string]interface{}{"keepalive": 4},
+		upstreamFields(&Upstream{Keepalive: 4}))
+}
+
 func TestNginxPlusGeneratesMetrics(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var rsp string
@@ -291,9 +387,23 @@ func TestNginxPlusGeneratesMetrics(t *testing.T) {
 		}
 	}
 
-	acc.AssertContainsTaggedFields(
+	infoTags := map[string]string{
+		"server":  host,
+		"port":    port,
+		"version": "1.22.333",
+		"address": "1.2.3.4",
+	}
+	assertTypedFields(t, &acc, "nginx_plus_info", telegraf.Counter,
+		map[string]interface{}{"generation": int(88)}, infoTags)
+	assertTypedFields(t, &acc, "nginx_plus_info", telegraf.Gauge,
+		map[string]interface{}{"load_timestamp": int64(1451606400000)}, infoTags)
+	assertSharedTimestamp(t, &acc, "nginx_plus_info")
+
+	assertTypedFields(
 		t,
+		&acc,
 		"nginx_plus_processes",
+		telegraf.Counter,
 		map[string]interface{}{
 			"respawned": int(9999),
 		},
@@ -302,23 +412,39 @@ func TestNginxPlusGeneratesMetrics(t *testing.T) {
 			"port":   port,
 		})
 
-	acc.AssertContainsTaggedFields(
+	assertTypedFields(
 		t,
+		&acc,
 		"nginx_plus_connections",
+		telegraf.Counter,
 		map[string]interface{}{
 			"accepted": int64(1234567890000),
 			"dropped":  int64(2345678900000),
-			"active":   int64(345),
-			"idle":     int64(567),
 		},
 		map[string]string{
 			"server": host,
 			"port":   port,
 		})
+	assertTypedFields(
+		t,
+		&acc,
+		"nginx_plus_connections",
+		telegraf.Gauge,
+		map[string]interface{}{
+			"active": int64(345),
+			"idle":   int64(567),
+		},
+		map[string]string{
+			"server": host,
+			"port":   port,
+		})
+	assertSharedTimestamp(t, &acc, "nginx_plus_connections")
 
-	acc.AssertContainsTaggedFields(
+	assertTypedFields(
 		t,
+		&acc,
 		"nginx_plus_ssl",
+		telegraf.Counter,
 		map[string]interface{}{
 			"handshakes":        int64(1234567800000),
 			"handshakes_failed": int64(5432100000000),
@@ -329,17 +455,31 @@ func TestNginxPlusGeneratesMetrics(t *testing.T) {
 			"port":   port,
 		})
 
-	acc.AssertContainsTaggedFields(
+	assertTypedFields(
+		t,
+		&acc,
+		"nginx_plus_requests",
+		telegraf.Counter,
+		map[string]interface{}{
+			"total": int64(9876543210000),
+		},
+		map[string]string{
+			"server": host,
+			"port":   port,
+		})
+	assertTypedFields(
 		t,
+		&acc,
 		"nginx_plus_requests",
+		telegraf.Gauge,
 		map[string]interface{}{
-			"total":   int64(9876543210000),
 			"current": int(98),
 		},
 		map[string]string{
 			"server": host,
 			"port":   port,
 		})
+	assertSharedTimestamp(t, &acc, "nginx_plus_requests")
 
 	acc.AssertContainsTaggedFields(
 		t,
@@ -383,6 +523,7 @@ func TestNginxPlusGeneratesMetrics(t *testing.T) {
 			"backup":                 false,
 			"weight":                 int(1),
 			"state":                  "up",
+			"state_code":             int(1),
 			"active":                 int(0),
 			"requests":               int64(9876),
 			"responses_1xx":          int64(1111),
@@ -407,7 +548,563 @@ func TestNginxPlusGeneratesMetrics(t *testing.T) {
 			"port":             port,
 			"upstream":         "first_upstream",
 			"upstream_address": "1.2.3.123:80",
+			"backup":           "false",
 			"id":               "0",
 		})
 
+	acc.AssertContainsTaggedFields(
+		t,
+		"nginx_plus_stream_upstream_peer",
+		map[string]interface{}{
+			"backup":                   false,
+			"weight":                   int(1),
+			"state":                    "up",
+			"state_code":               int(1),
+			"active":                   int(0),
+			"connections":              int64(0),
+			"sent":                     int64(0),
+			"received":                 int64(0),
+			"fails":                    int64(0),
+			"unavail":                  int64(0),
+			"healthchecks_checks":      int64(40848),
+			"healthchecks_fails":       int64(0),
+			"healthchecks_unhealthy":   int64(0),
+			"healthchecks_last_passed": true,
+			"downtime":                 int64(0),
+			"downstart":                int64(0),
+			"selected":                 int64(0),
+		},
+		map[string]string{
+			"server":           host,
+			"port":             port,
+			"upstream":         "upstream.01",
+			"upstream_address": "4.3.2.1:2345",
+			"backup":           "false",
+			"id":               "0",
+		})
+
+	acc.AssertContainsTaggedFields(
+		t,
+		"nginx_plus_cache",
+		map[string]interface{}{
+			"size":                      int64(12),
+			"max_size":                  int64(23),
+			"cold":                      false,
+			"hit_responses":             int64(34),
+			"hit_bytes":                 int64(45),
+			"stale_responses":           int64(56),
+			"stale_bytes":               int64(67),
+			"updating_responses":        int64(78),
+			"updating_bytes":            int64(89),
+			"revalidated_responses":     int64(90),
+			"revalidated_bytes":         int64(98),
+			"miss_responses":            int64(87),
+			"miss_bytes":                int64(76),
+			"miss_responses_written":    int64(65),
+			"miss_bytes_written":        int64(54),
+			"expired_responses":         int64(43),
+			"expired_bytes":             int64(32),
+			"expired_responses_written": int64(21),
+			"expired_bytes_written":     int64(10),
+			"bypass_responses":          int64(13),
+			"bypass_bytes":              int64(35),
+			"bypass_responses_written":  int64(57),
+			"bypass_bytes_written":      int64(79),
+		},
+		map[string]string{
+			"server": host,
+			"port":   port,
+			"zone":   "cache_01",
+		})
+
+	acc.AssertContainsTaggedFields(
+		t,
+		"nginx_plus_resolver",
+		map[string]interface{}{
+			"requests_name":      int64(101),
+			"requests_srv":       int64(2),
+			"requests_addr":      int64(3),
+			"responses_noerror":  int64(97),
+			"responses_formerr":  int64(0),
+			"responses_servfail": int64(1),
+			"responses_nxdomain": int64(6),
+			"responses_notimp":   int64(0),
+			"responses_refused":  int64(0),
+			"responses_timedout": int64(2),
+			"responses_unknown":  int64(0),
+		},
+		map[string]string{
+			"server": host,
+			"port":   port,
+			"zone":   "resolver_01",
+		})
+
+	acc.AssertContainsTaggedFields(
+		t,
+		"nginx_plus_slab",
+		map[string]interface{}{
+			"pages_used": int64(3),
+			"pages_free": int64(61),
+			"requests":   int64(35),
+			"fails":      int64(3),
+		},
+		map[string]string{
+			"server": host,
+			"port":   port,
+			"zone":   "keyval_zone",
+		})
+
+	acc.AssertContainsTaggedFields(
+		t,
+		"nginx_plus_stream_server_zone",
+		map[string]interface{}{
+			"processing":     int(24),
+			"connections":    int(46),
+			"sessions_2xx":   int64(40),
+			"sessions_4xx":   int64(4),
+			"sessions_5xx":   int64(2),
+			"sessions_total": int64(46),
+			"discarded":      int64(1),
+			"received":       int64(68),
+			"sent":           int64(80),
+		},
+		map[string]string{
+			"server": host,
+			"port":   port,
+			"zone":   "stream.zone.01",
+		})
+
+	acc.AssertContainsTaggedFields(
+		t,
+		"nginx_plus_stream_server_zone",
+		map[string]interface{}{
+			"processing":  int(96),
+			"connections": int(63),
+			"received":    int64(31),
+			"sent":        int64(25),
+		},
+		map[string]string{
+			"server": host,
+			"port":   port,
+			"zone":   "stream.zone.02",
+		})
+}
+
+func TestNginxPlusSniffJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if r.URL.Path == "/text" {
+			fmt.Fprint(w, "Active connections: 1\n")
+			return
+		}
+		fmt.Fprint(w, "\n  "+sampleStatusResponse)
+	}))
+	defer ts.Close()
+
+	n := &NginxPlus{
+		Urls: []string{fmt.Sprintf("%s/status", ts.URL)},
+	}
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(n.Gather))
+	assert.True(t, acc.HasMeasurement("nginx_plus_processes"))
+	assert.True(t, acc.HasMeasurement("nginx_plus_upstream"))
+
+	n = &NginxPlus{
+		Urls: []string{fmt.Sprintf("%s/text", ts.URL)},
+	}
+	var accText testutil.Accumulator
+	err := accText.GatherError(n.Gather)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected content type text/plain")
+}
+
+func TestNginxPlusIsJSONObject(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"{}", true},
+		{" \r\n\t{\"version\": 1}", true},
+		{"", false},
+		{"   ", false},
+		{"[1, 2]", false},
+		{"Active connections: 1", false},
+	}
+	for _, tt := range tests {
+		r := bufio.NewReader(strings.NewReader(tt.input))
+		assert.Equal(t, tt.expected, isJSONObject(r), "input %q", tt.input)
+		// Nothing is consumed
+		rest, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, tt.input, string(rest))
+	}
+}
+
+func TestNginxPlusWithoutStream(t *testing.T) {
+	status := &Status{}
+	var acc testutil.Accumulator
+
+	status.gatherStreamMetrics(map[string]string{}, &acc)
+	status.gatherResolverMetrics(map[string]string{}, &acc)
+
+	acc.AssertDoesNotContainMeasurement(t, "nginx_plus_resolver")
+	acc.AssertDoesNotContainMeasurement(t, "nginx_plus_stream_server_zone")
+	acc.AssertDoesNotContainMeasurement(t, "nginx_plus_stream_upstream")
+}
+
+func TestNginxPlusWithoutZoneSync(t *testing.T) {
+	status := &Status{}
+	var acc testutil.Accumulator
+
+	status.gatherZoneSyncMetrics(map[string]string{}, &acc)
+
+	acc.AssertDoesNotContainMeasurement(t, "nginx_plus_zone_sync")
+}
+
+func TestNginxPlusZoneSync(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader(`{
+		"version": 6,
+		"stream": {
+			"zone_sync": {
+				"status": {
+					"bytes_in": 2048,
+					"msgs_in": 90,
+					"msgs_out": 85,
+					"bytes_out": 1024,
+					"nodes_online": 3
+				},
+				"zones": {
+					"sessions": {"records_pending": 2, "records_total": 500},
+					"limits": {"records_pending": 0, "records_total": 12}
+				}
+			}
+		}
+	}`))
+	tags := map[string]string{"server": "localhost"}
+
+	var acc testutil.Accumulator
+	require.NoError(t, gatherStatusUrl(r, tags, &acc))
+
+	assertTypedFields(t, &acc, "nginx_plus_zone_sync", telegraf.Counter,
+		map[string]interface{}{
+			"bytes_in":  int64(2048),
+			"msgs_in":   int64(90),
+			"msgs_out":  int64(85),
+			"bytes_out": int64(1024),
+		},
+		tags)
+	assertTypedFields(t, &acc, "nginx_plus_zone_sync", telegraf.Gauge,
+		map[string]interface{}{
+			"nodes_online": int64(3),
+		},
+		tags)
+	assertTypedFields(t, &acc, "nginx_plus_zone_sync", telegraf.Gauge,
+		map[string]interface{}{
+			"records_pending": int64(2),
+			"records_total":   int64(500),
+		},
+		map[string]string{"server": "localhost", "zone": "sessions"})
+	assertTypedFields(t, &acc, "nginx_plus_zone_sync", telegraf.Gauge,
+		map[string]interface{}{
+			"records_pending": int64(0),
+			"records_total":   int64(12),
+		},
+		map[string]string{"server": "localhost", "zone": "limits"})
+	assertSharedTimestamp(t, &acc, "nginx_plus_zone_sync")
+}
+
+func TestNginxPlusWithoutConnections(t *testing.T) {
+	status := &Status{}
+	var acc testutil.Accumulator
+
+	status.gatherConnectionsMetrics(map[string]string{}, &acc)
+
+	acc.AssertDoesNotContainMeasurement(t, "nginx_plus_connections")
+}
+
+func TestNginxPlusWithoutProcesses(t *testing.T) {
+	status := &Status{}
+	var acc testutil.Accumulator
+
+	status.gatherProcessesMetrics(map[string]string{}, &acc)
+
+	acc.AssertDoesNotContainMeasurement(t, "nginx_plus_processes")
+}
+
+func TestNginxPlusWithoutSsl(t *testing.T) {
+	status := &Status{}
+	var acc testutil.Accumulator
+
+	status.gatherSslMetrics(map[string]string{}, &acc)
+
+	acc.AssertDoesNotContainMeasurement(t, "nginx_plus_ssl")
+}
+
+func TestNginxPlusZonePartialResponses(t *testing.T) {
+	status := &Status{}
+	err := json.Unmarshal([]byte(`{
+		"server_zones": {
+			"old": {
+				"processing": 1,
+				"requests": 10,
+				"responses": {"2xx": 9, "5xx": 1},
+				"received": 2,
+				"sent": 3
+			},
+			"bare": {
+				"requests": 4
+			}
+		}
+	}`), status)
+	require.NoError(t, err)
+
+	var acc testutil.Accumulator
+	status.gatherZoneMetrics(map[string]string{}, &acc)
+
+	acc.AssertContainsTaggedFields(
+		t,
+		"nginx_plus_zone",
+		map[string]interface{}{
+			"processing":      int(1),
+			"requests":        int64(10),
+			"responses_1xx":   int64(0),
+			"responses_2xx":   int64(9),
+			"responses_3xx":   int64(0),
+			"responses_4xx":   int64(0),
+			"responses_5xx":   int64(1),
+			"responses_total": int64(0),
+			"received":        int64(2),
+			"sent":            int64(3),
+		},
+		map[string]string{"zone": "old"})
+
+	acc.AssertContainsTaggedFields(
+		t,
+		"nginx_plus_zone",
+		map[string]interface{}{
+			"processing":      int(0),
+			"requests":        int64(4),
+			"responses_1xx":   int64(0),
+			"responses_2xx":   int64(0),
+			"responses_3xx":   int64(0),
+			"responses_4xx":   int64(0),
+			"responses_5xx":   int64(0),
+			"responses_total": int64(0),
+			"received":        int64(0),
+			"sent":            int64(0),
+		},
+		map[string]string{"zone": "bare"})
+}
+
+func TestNginxPlusLocationZones(t *testing.T) {
+	status := &Status{}
+	err := json.Unmarshal([]byte(`{
+		"location_zones": {
+			"api": {
+				"requests": 42,
+				"responses": {"1xx": 0, "2xx": 40, "3xx": 0, "4xx": 1, "5xx": 1, "total": 42},
+				"discarded": 1,
+				"received": 2000,
+				"sent": 8000
+			}
+		}
+	}`), status)
+	require.NoError(t, err)
+
+	var acc testutil.Accumulator
+	status.gatherLocationZoneMetrics(map[string]string{"server": "localhost"}, &acc)
+
+	acc.AssertContainsTaggedFields(t, "nginx_plus_location_zone",
+		map[string]interface{}{
+			"requests":        int64(42),
+			"responses_1xx":   int64(0),
+			"responses_2xx":   int64(40),
+			"responses_3xx":   int64(0),
+			"responses_4xx":   int64(1),
+			"responses_5xx":   int64(1),
+			"responses_total": int64(42),
+			"discarded":       int64(1),
+			"received":        int64(2000),
+			"sent":            int64(8000),
+		},
+		map[string]string{"server": "localhost", "zone": "api"})
+}
+
+func TestNginxPlusCacheWithoutRevalidated(t *testing.T) {
+	status := &Status{}
+	err := json.Unmarshal([]byte(`{
+		"caches": {
+			"v2": {
+				"size": 1,
+				"max_size": 2,
+				"cold": true,
+				"hit": {"responses": 3, "bytes": 4}
+			}
+		}
+	}`), status)
+	require.NoError(t, err)
+
+	var acc testutil.Accumulator
+	status.gatherCacheMetrics(map[string]string{}, &acc)
+
+	assert.True(t, acc.HasInt64Field("nginx_plus_cache", "hit_responses"))
+	assert.False(t, acc.HasField("nginx_plus_cache", "revalidated_responses"))
+	assert.False(t, acc.HasField("nginx_plus_cache", "revalidated_bytes"))
+}
+
+func TestNginxPlusCacheColdNumeric(t *testing.T) {
+	for body, cold := range map[string]bool{
+		`{"caches": {"c": {"size": 10, "max_size": 20, "cold": 1}}}`:     true,
+		`{"caches": {"c": {"size": 10, "max_size": 20, "cold": 0}}}`:     false,
+		`{"caches": {"c": {"size": 10, "max_size": 20, "cold": true}}}`:  true,
+		`{"caches": {"c": {"size": 10, "max_size": 20, "cold": false}}}`: false,
+	} {
+		status := &Status{}
+		require.NoError(t, json.Unmarshal([]byte(body), status), body)
+
+		var acc testutil.Accumulator
+		status.gatherCacheMetrics(map[string]string{}, &acc)
+		require.Len(t, acc.Metrics, 1, body)
+		fields := acc.Metrics[0].Fields
+		assert.Equal(t, cold, fields["cold"], body)
+		assert.Equal(t, int64(10), fields["size"], body)
+		assert.Equal(t, int64(20), fields["max_size"], body)
+	}
+
+	status := &Status{}
+	assert.Error(t, json.Unmarshal([]byte(`{"caches": {"c": {"cold": "maybe"}}}`), status))
+}
+
+// metricsByKey indexes the gathered fields by measurement and tags
+func metricsByKey(acc *testutil.Accumulator) map[string]map[string]interface{} {
+	metrics := map[string]map[string]interface{}{}
+	for _, m := range acc.Metrics {
+		var tags []string
+		for k, v := range m.Tags {
+			tags = append(tags, k+"="+v)
+		}
+		sort.Strings(tags)
+		metrics[m.Measurement+","+strings.Join(tags, ",")] = m.Fields
+	}
+	return metrics
+}
+
+func TestNginxPlusStreamingDecodeMatchesFullDecode(t *testing.T) {
+	tags := map[string]string{"server": "localhost", "port": "80"}
+
+	var accStream testutil.Accumulator
+	err := gatherStatusUrl(bufio.NewReader(strings.NewReader(sampleStatusResponse)), tags, &accStream)
+	require.NoError(t, err)
+
+	status := &Status{}
+	require.NoError(t, json.Unmarshal([]byte(sampleStatusResponse), status))
+	var accFull testutil.Accumulator
+	status.Gather(tags, &accFull)
+
+	streamed := metricsByKey(&accStream)
+	assert.Equal(t,
+		map[string]interface{}{"parse_errors": 0},
+		streamed["nginx_plus_scrape,port=80,server=localhost"])
+	delete(streamed, "nginx_plus_scrape,port=80,server=localhost")
+	assert.Equal(t, len(accFull.Metrics), len(accStream.Metrics)-1)
+	assert.Equal(t, metricsByKey(&accFull), streamed)
+}
+
+func TestNginxPlusParseErrors(t *testing.T) {
+	body := `{
+		"processes": {"respawned": 0},
+		"ssl": {"handshakes": 1, "handshakes_failed": 0, "session_reuses": 0},
+		"connections": {"accepted": "many", "dropped": 1, "active": 2, "idle": 3},
+		"requests": {"total": 10, "current": 1},
+		"upstreams": {
+			"broken": {"peers": {}},
+			"ok": {"peers": [{"id": 0, "server": "10.0.0.1:80", "state": "up"}]}
+		}
+	}`
+
+	var acc testutil.Accumulator
+	err := gatherStatusUrl(bufio.NewReader(strings.NewReader(body)), map[string]string{}, &acc)
+	require.NoError(t, err)
+
+	acc.AssertContainsFields(t, "nginx_plus_scrape", map[string]interface{}{"parse_errors": 2})
+	assertTypedFields(t, &acc, "nginx_plus_requests", telegraf.Counter,
+		map[string]interface{}{"total": int64(10)}, map[string]string{})
+	assertTypedFields(t, &acc, "nginx_plus_requests", telegraf.Gauge,
+		map[string]interface{}{"current": 1}, map[string]string{})
+	v, ok := acc.Int64Field("nginx_plus_connections", "dropped")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), v)
+	assert.True(t, acc.HasTag("nginx_plus_upstream_peer", "upstream"))
+	assert.Equal(t, "ok", acc.TagValue("nginx_plus_upstream_peer", "upstream"))
+}
+
+func TestNginxPlusStreamingDecodeInvalid(t *testing.T) {
+	var acc testutil.Accumulator
+	for _, body := range []string{`[]`, `{"upstreams": [1]}`, `{"upstreams": {"u": {`} {
+		err := gatherStatusUrl(bufio.NewReader(strings.NewReader(body)), map[string]string{}, &acc)
+		assert.Error(t, err, body)
+	}
+}
+
+// largeStatusResponse builds a status document with the given number of
+// upstreams of ten peers each.
+func largeStatusResponse(upstreams int) []byte {
+	status := &Status{}
+	if err := json.Unmarshal([]byte(sampleStatusResponse), status); err != nil {
+		panic(err)
+	}
+
+	var peer UpstreamPeer
+	for _, upstream := range status.Upstreams {
+		peer = upstream.Peers[0]
+	}
+	status.Upstreams = make(map[string]Upstream, upstreams)
+	for i := 0; i < upstreams; i++ {
+		upstream := Upstream{Keepalive: 1}
+		for j := 0; j < 10; j++ {
+			id := j
+			peer.ID = &id
+			peer.Server = fmt.Sprintf("10.0.%d.%d:8080", i%256, j)
+			upstream.Peers = append(upstream.Peers, peer)
+		}
+		status.Upstreams[fmt.Sprintf("upstream_%d", i)] = upstream
+	}
+
+	body, err := json.Marshal(status)
+	if err != nil {
+		panic(err)
+	}
+	return body
+}
+
+func BenchmarkNginxPlusGatherStatusStreaming(b *testing.B) {
+	body := largeStatusResponse(2000)
+	tags := map[string]string{}
+	acc := testutil.Accumulator{Discard: true}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := gatherStatusUrl(bufio.NewReader(bytes.NewReader(body)), tags, &acc)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkNginxPlusGatherStatusBuffered is the previous approach decoding
+// the whole document before gathering, kept for comparison.
+func BenchmarkNginxPlusGatherStatusBuffered(b *testing.B) {
+	body := largeStatusResponse(2000)
+	tags := map[string]string{}
+	acc := testutil.Accumulator{Discard: true}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		status := &Status{}
+		err := json.NewDecoder(bufio.NewReader(bytes.NewReader(body))).Decode(status)
+		if err != nil {
+			b.Fatal(err)
+		}
+		status.Gather(tags, &acc)
+	}
 }